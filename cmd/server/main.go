@@ -6,17 +6,28 @@ import (
 	"wepay-sandbox/internal/api/admin"
 	"wepay-sandbox/internal/api/mock"
 	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	port := flag.String("port", "8080", "Server port")
+	flag.StringVar(&core.PublicURL, "public-url", "", "Public base URL of the sandbox, used in code_url etc. (default: request host)")
+	flag.StringVar(&core.WebURL, "web-url", "", "Base URL of the web console (default: request host with port 3000)")
 	flag.Parse()
 
 	// 初始化数据库
 	core.InitDB("sandbox.db")
 
+	// 恢复服务重启前未处理完的退款、分账及转账
+	service.ResumeRefunds()
+	service.ResumeProfitSharing()
+	service.ResumeTransfers()
+
+	// 定时关闭超过 time_expire 仍未支付的订单
+	service.StartOrderExpiry()
+
 	r := gin.Default()
 
 	// 允许跨域
@@ -31,16 +42,57 @@ func main() {
 		c.Next()
 	})
 
-	// Mock API (Open)
-	v3 := r.Group("/v3")
+	// Mock API (Open，应答统一签名；商户开启严格模式时校验请求签名)
+	v3 := r.Group("/v3", mock.SignResponse(), mock.VerifySignature())
 	{
 		v3.POST("/pay/transactions/jsapi", mock.JSAPIPrepay)
 		v3.POST("/pay/transactions/app", mock.AppPrepay)
+		v3.POST("/pay/transactions/native", mock.NativePrepay)
+		v3.POST("/pay/transactions/h5", mock.H5Prepay)
+		v3.POST("/pay/transactions/micropay", mock.Micropay)
 		v3.GET("/pay/transactions/id/:transaction_id", mock.QueryByTransactionID)
 		v3.GET("/pay/transactions/out-trade-no/:out_trade_no", mock.QueryByOutTradeNo)
 		v3.POST("/pay/transactions/out-trade-no/:out_trade_no/close", mock.CloseOrder)
+		v3.POST("/pay/transactions/out-trade-no/:out_trade_no/reverse", mock.ReverseOrder)
+		v3.POST("/refund/domestic/refunds", mock.CreateRefund)
+		v3.GET("/refund/domestic/refunds/:out_refund_no", mock.QueryRefund)
+		v3.POST("/refund/domestic/refunds/:refund_id/apply-abnormal-refund", mock.ApplyAbnormalRefund)
+		v3.GET("/certificates", mock.DownloadCertificates)
+		v3.POST("/pay/partner/transactions/jsapi", mock.PartnerJSAPIPrepay)
+		v3.POST("/pay/partner/transactions/app", mock.PartnerAppPrepay)
+		v3.POST("/pay/partner/transactions/native", mock.PartnerNativePrepay)
+		v3.POST("/pay/partner/transactions/h5", mock.PartnerH5Prepay)
+		v3.GET("/pay/partner/transactions/id/:transaction_id", mock.PartnerQueryByTransactionID)
+		v3.GET("/pay/partner/transactions/out-trade-no/:out_trade_no", mock.PartnerQueryByOutTradeNo)
+		v3.POST("/pay/partner/transactions/out-trade-no/:out_trade_no/close", mock.PartnerCloseOrder)
+		v3.POST("/profitsharing/receivers/add", mock.AddProfitSharingReceiver)
+		v3.POST("/profitsharing/receivers/delete", mock.DeleteProfitSharingReceiver)
+		v3.POST("/profitsharing/orders", mock.CreateProfitSharingOrder)
+		v3.GET("/profitsharing/orders/:out_order_no", mock.QueryProfitSharingOrder)
+		v3.POST("/profitsharing/orders/unfreeze", mock.UnfreezeProfitSharingOrder)
+		v3.POST("/profitsharing/return-orders", mock.CreateProfitSharingReturn)
+		v3.GET("/profitsharing/return-orders/:out_return_no", mock.QueryProfitSharingReturn)
+		v3.GET("/profitsharing/transactions/:transaction_id/amounts", mock.QueryUnsplitAmount)
+		v3.GET("/bill/tradebill", mock.TradeBill)
+		v3.GET("/bill/fundflowbill", mock.FundFlowBill)
+		v3.GET("/billdownload/file", mock.DownloadBill)
+		v3.POST("/transfer/batches", mock.CreateTransferBatch)
+		v3.GET("/transfer/batches/batch-id/:batch_id", mock.QueryTransferBatchByID)
+		v3.GET("/transfer/batches/out-batch-no/:out_batch_no", mock.QueryTransferBatchByOutNo)
+		v3.GET("/transfer/batches/batch-id/:batch_id/details/detail-id/:detail_id", mock.QueryTransferDetailByID)
+		v3.GET("/transfer/batches/out-batch-no/:out_batch_no/details/out-detail-no/:out_detail_no", mock.QueryTransferDetailByOutNo)
+		v3.POST("/combine-transactions/jsapi", mock.CombineJSAPIPrepay)
+		v3.POST("/combine-transactions/app", mock.CombineAppPrepay)
+		v3.POST("/combine-transactions/h5", mock.CombineH5Prepay)
+		v3.POST("/combine-transactions/native", mock.CombineNativePrepay)
+		v3.GET("/combine-transactions/out-trade-no/:combine_out_trade_no", mock.QueryCombineOrder)
+		v3.POST("/combine-transactions/out-trade-no/:combine_out_trade_no/close", mock.CloseCombineOrder)
 	}
 
+	// 支付落地页 (Native code_url 扫码、H5 h5_url 打开后跳转至支付模拟页)
+	r.GET("/pay/native/:prepay_id", mock.NativeRedirect)
+	r.GET("/pay/h5", mock.H5Redirect)
+
 	// Internal API (Admin)
 	internal := r.Group("/api/internal")
 	{
@@ -48,6 +100,12 @@ func main() {
 		internal.POST("/merchants", admin.CreateMerchant)
 		internal.PUT("/merchants/:id", admin.UpdateMerchant)
 		internal.DELETE("/merchants", admin.DeleteMerchants)
+		internal.GET("/merchants/:id/appids", admin.ListMerchantAppIDs)
+		internal.POST("/merchants/:id/appids", admin.AddMerchantAppID)
+		internal.DELETE("/merchants/:id/appids/:appid", admin.DeleteMerchantAppID)
+		internal.GET("/merchants/:id/platform-cert", admin.GetPlatformCert)
+		internal.GET("/merchants/:id/platform-certs", admin.ListPlatformCerts)
+		internal.POST("/merchants/:id/platform-cert/rotate", admin.RotatePlatformCert)
 
 		internal.GET("/transactions", admin.ListTransactions)
 		internal.DELETE("/transactions", admin.DeleteTransactions)
@@ -60,6 +118,17 @@ func main() {
 		internal.DELETE("/refunds", admin.DeleteRefunds)
 		internal.GET("/refunds/:refund_id/logs", admin.GetRefundLogs)
 		internal.POST("/refunds/:refund_id/retry-callback", admin.RetryRefundCallback)
+		internal.POST("/refunds/:refund_id/complete", admin.CompleteRefund)
+
+		internal.GET("/profitsharing/orders", admin.ListProfitSharingOrders)
+		internal.GET("/profitsharing/receivers", admin.ListProfitSharingReceivers)
+		internal.GET("/profitsharing/returns", admin.ListProfitSharingReturns)
+
+		internal.GET("/transfer/batches", admin.ListTransferBatches)
+		internal.GET("/transfer/batches/:batch_id/logs", admin.GetTransferBatchLogs)
+		internal.POST("/transfer/details/:detail_id/complete", admin.CompleteTransferDetail)
+
+		internal.GET("/qrcode", admin.QRCode)
 
 		internal.GET("/events", api.StreamEvents)
 	}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"wepay-sandbox/internal/core"
 
 	"github.com/gin-gonic/gin"
 )
 
+// APIV3Key 与沙箱控制台中商户配置的 APIv3 密钥保持一致，用于解密回调 resource
+const APIV3Key = "01234567890123456789012345678901"
+
 func main() {
 	// 设置 Gin 为发布模式，减少干扰日志
 	gin.SetMode(gin.ReleaseMode)
@@ -26,6 +31,23 @@ func main() {
 		// 打印接收到的回调内容
 		log.Printf("\n========== 收到微信支付回调 ==========\n%s\n======================================\n", string(body))
 
+		// 解密 resource (AEAD_AES_256_GCM)
+		var notify struct {
+			Resource struct {
+				Ciphertext     string `json:"ciphertext"`
+				AssociatedData string `json:"associated_data"`
+				Nonce          string `json:"nonce"`
+			} `json:"resource"`
+		}
+		if err := json.Unmarshal(body, &notify); err == nil {
+			plaintext, err := core.DecryptAESGCM(APIV3Key, notify.Resource.Nonce, notify.Resource.AssociatedData, notify.Resource.Ciphertext)
+			if err != nil {
+				log.Printf("解密失败: %v", err)
+			} else {
+				log.Printf("解密后的通知数据: %s", string(plaintext))
+			}
+		}
+
 		// 按照微信支付V3文档要求，返回 200 或 204 即可代表处理成功
 		// 这里返回 200 OK 和一个简单的 JSON 结构
 		c.JSON(http.StatusOK, gin.H{
@@ -1,6 +1,8 @@
 package admin
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"wepay-sandbox/internal/core"
 	"wepay-sandbox/internal/model"
@@ -27,6 +29,23 @@ func CreateMerchant(c *gin.Context) {
 		return
 	}
 
+	if err := checkAPIV3Key(m.APIV3Key); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "error": err.Error()})
+		return
+	}
+
+	if m.ClientCert != "" {
+		if _, _, err := core.ParseRSAPublicKey(m.ClientCert); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client certificate: " + err.Error()})
+			return
+		}
+	}
+
+	if err := checkParentMchID(m.MchID, m.ParentMchID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if result := core.DB.Create(&m); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -44,16 +63,94 @@ func UpdateMerchant(c *gin.Context) {
 		return
 	}
 
-	var input model.Merchant
+	// 布尔字段单独处理，避免 Updates(struct) 忽略 false 值
+	var input struct {
+		model.Merchant
+		NotifyDebug *bool   `json:"notify_debug"`
+		StrictSign  *bool   `json:"strict_sign"`
+		RelaxNotify *bool   `json:"relax_notify_url"`
+		ParentMchID *string `json:"parent_mchid"` // 传空字符串表示解除服务商关系
+	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	core.DB.Model(&m).Updates(input)
+	// 未传 api_v3_key 时保持原密钥
+	if input.APIV3Key != "" {
+		if err := checkAPIV3Key(input.APIV3Key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "error": err.Error()})
+			return
+		}
+	}
+
+	if input.ClientCert != "" {
+		if _, _, err := core.ParseRSAPublicKey(input.ClientCert); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client certificate: " + err.Error()})
+			return
+		}
+	}
+
+	if input.ParentMchID != nil {
+		mchid := m.MchID
+		if input.MchID != "" {
+			mchid = input.MchID
+		}
+		if err := checkParentMchID(mchid, *input.ParentMchID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	core.DB.Model(&m).Updates(input.Merchant)
+	if input.NotifyDebug != nil {
+		core.DB.Model(&m).Update("notify_debug", *input.NotifyDebug)
+	}
+	if input.StrictSign != nil {
+		core.DB.Model(&m).Update("strict_sign", *input.StrictSign)
+	}
+	if input.RelaxNotify != nil {
+		core.DB.Model(&m).Update("relax_notify_url", *input.RelaxNotify)
+	}
+	if input.ParentMchID != nil {
+		core.DB.Model(&m).Update("parent_mch_id", *input.ParentMchID)
+	}
 	c.JSON(http.StatusOK, m)
 }
 
+// checkAPIV3Key 校验 APIv3 密钥：AEAD_AES_256_GCM 要求 32 字节
+func checkAPIV3Key(key string) error {
+	if len(key) != 32 {
+		return fmt.Errorf("api_v3_key must be 32 bytes, got %d", len(key))
+	}
+	return nil
+}
+
+// checkParentMchID 校验所属服务商：必须是已配置的商户，不能是自身，且自身不能是特约商户 (不支持多级)
+func checkParentMchID(mchid, parentMchID string) error {
+	if parentMchID == "" {
+		return nil
+	}
+	if parentMchID == mchid {
+		return errors.New("parent_mchid cannot be the merchant itself")
+	}
+
+	var parent model.Merchant
+	if result := core.DB.Where("mch_id = ?", parentMchID).First(&parent); result.Error != nil {
+		return errors.New("parent merchant not found: " + parentMchID)
+	}
+	if parent.ParentMchID != "" {
+		return errors.New("parent merchant is a sub-merchant itself")
+	}
+
+	var subCount int64
+	core.DB.Model(&model.Merchant{}).Where("parent_mch_id = ?", mchid).Count(&subCount)
+	if subCount > 0 {
+		return errors.New("merchant has sub-merchants and cannot become a sub-merchant")
+	}
+	return nil
+}
+
 // DeleteMerchants 批量删除商户 (硬删除)
 func DeleteMerchants(c *gin.Context) {
 	var ids []uint
@@ -67,11 +164,149 @@ func DeleteMerchants(c *gin.Context) {
 		return
 	}
 
+	// 同时删除商户绑定的 appid
+	var mchids []string
+	core.DB.Unscoped().Model(&model.Merchant{}).Where("id IN ?", ids).Pluck("mch_id", &mchids)
+
 	// Unscoped() 用于硬删除
 	if result := core.DB.Unscoped().Delete(&model.Merchant{}, ids); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	core.DB.Where("mch_id IN ?", mchids).Delete(&model.MerchantAppID{})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted successfully"})
 }
+
+// ListMerchantAppIDs 获取商户绑定的其他 appid (不含商户自身的 AppID)
+func ListMerchantAppIDs(c *gin.Context) {
+	var m model.Merchant
+	if result := core.DB.First(&m, c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	var bindings []model.MerchantAppID
+	if result := core.DB.Where("mch_id = ?", m.MchID).Order("created_at").Find(&bindings); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, bindings)
+}
+
+// AddMerchantAppID 为商户绑定 appid
+func AddMerchantAppID(c *gin.Context) {
+	var m model.Merchant
+	if result := core.DB.First(&m, c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	var input struct {
+		AppID       string `json:"appid" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.AppID == m.AppID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "appid is the merchant's own AppID"})
+		return
+	}
+
+	var count int64
+	core.DB.Model(&model.MerchantAppID{}).Where("mch_id = ? AND app_id = ?", m.MchID, input.AppID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "appid already bound: " + input.AppID})
+		return
+	}
+
+	binding := model.MerchantAppID{MchID: m.MchID, AppID: input.AppID, Description: input.Description}
+	if result := core.DB.Create(&binding); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, binding)
+}
+
+// DeleteMerchantAppID 解除商户与 appid 的绑定
+func DeleteMerchantAppID(c *gin.Context) {
+	var m model.Merchant
+	if result := core.DB.First(&m, c.Param("id")); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	result := core.DB.Where("mch_id = ? AND app_id = ?", m.MchID, c.Param("appid")).Delete(&model.MerchantAppID{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "appid not bound: " + c.Param("appid")})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted successfully"})
+}
+
+// GetPlatformCert 获取商户当前的沙箱平台证书 (用于业务端验签)
+func GetPlatformCert(c *gin.Context) {
+	id := c.Param("id")
+	var m model.Merchant
+	if result := core.DB.First(&m, id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	cert, err := core.GetPlatformCert(m.MchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ?format=pem 时直接下载证书文件
+	if c.Query("format") == "pem" {
+		c.Header("Content-Disposition", "attachment; filename=wechatpay_"+cert.SerialNo+".pem")
+		c.Data(http.StatusOK, "application/x-pem-file", []byte(cert.Certificate))
+		return
+	}
+
+	c.JSON(http.StatusOK, cert)
+}
+
+// RotatePlatformCert 轮换商户平台证书 (旧证书在过期前仍可通过 /v3/certificates 下载)
+func RotatePlatformCert(c *gin.Context) {
+	id := c.Param("id")
+	var m model.Merchant
+	if result := core.DB.First(&m, id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	cert, err := core.RotatePlatformCert(m.MchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cert)
+}
+
+// ListPlatformCerts 获取商户全部有效平台证书
+func ListPlatformCerts(c *gin.Context) {
+	id := c.Param("id")
+	var m model.Merchant
+	if result := core.DB.First(&m, id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+
+	certs, err := core.ListPlatformCerts(m.MchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, certs)
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMerchantAppIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+	core.DB.Create(&model.Merchant{AppID: "wx200", MchID: "200"})
+
+	r := gin.New()
+	r.GET("/merchants/:id/appids", ListMerchantAppIDs)
+	r.POST("/merchants/:id/appids", AddMerchantAppID)
+	r.DELETE("/merchants/:id/appids/:appid", DeleteMerchantAppID)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"bind appid", http.MethodPost, "/merchants/1/appids", `{"appid": "wx_mini", "description": "小程序"}`, http.StatusOK},
+		{"bind twice", http.MethodPost, "/merchants/1/appids", `{"appid": "wx_mini"}`, http.StatusBadRequest},
+		{"bind own appid", http.MethodPost, "/merchants/1/appids", `{"appid": "wx100"}`, http.StatusBadRequest},
+		{"bind to another merchant", http.MethodPost, "/merchants/2/appids", `{"appid": "wx_mini"}`, http.StatusOK},
+		{"missing appid", http.MethodPost, "/merchants/1/appids", `{}`, http.StatusBadRequest},
+		{"unknown merchant", http.MethodPost, "/merchants/99/appids", `{"appid": "wx_app"}`, http.StatusNotFound},
+		{"unbind", http.MethodDelete, "/merchants/1/appids/wx_mini", "", http.StatusOK},
+		{"unbind twice", http.MethodDelete, "/merchants/1/appids/wx_mini", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d (%s), want %d", tt.name, w.Code, w.Body.String(), tt.wantStatus)
+		}
+	}
+
+	// 解除商户 100 的绑定不影响商户 200
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/merchants/2/appids", nil))
+	var bindings []model.MerchantAppID
+	if err := json.Unmarshal(w.Body.Bytes(), &bindings); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	if len(bindings) != 1 || bindings[0].AppID != "wx_mini" || bindings[0].MchID != "200" {
+		t.Errorf("merchant 200 bindings = %+v", bindings)
+	}
+}
+
+func TestMerchantAPIV3Key(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+
+	r := gin.New()
+	r.POST("/merchants", CreateMerchant)
+	r.PUT("/merchants/:id", UpdateMerchant)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"create without key", http.MethodPost, "/merchants", `{"appid": "wx100", "mchid": "100"}`, http.StatusBadRequest},
+		{"create with short key", http.MethodPost, "/merchants", `{"appid": "wx100", "mchid": "100", "api_v3_key": "0123456789"}`, http.StatusBadRequest},
+		{"create", http.MethodPost, "/merchants", `{"appid": "wx100", "mchid": "100", "api_v3_key": "01234567890123456789012345678901"}`, http.StatusOK},
+		{"update with long key", http.MethodPut, "/merchants/1", `{"api_v3_key": "012345678901234567890123456789012"}`, http.StatusBadRequest},
+		{"update other fields", http.MethodPut, "/merchants/1", `{"description": "测试商户"}`, http.StatusOK},
+		{"update key", http.MethodPut, "/merchants/1", `{"api_v3_key": "abcdefghijabcdefghijabcdefghijab"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d (%s), want %d", tt.name, w.Code, w.Body.String(), tt.wantStatus)
+		}
+		if w.Code == http.StatusBadRequest && !strings.Contains(w.Body.String(), "PARAM_ERROR") {
+			t.Errorf("%s: response = %s, want PARAM_ERROR", tt.name, w.Body.String())
+		}
+	}
+
+	var m model.Merchant
+	core.DB.First(&m, 1)
+	if m.APIV3Key != "abcdefghijabcdefghijabcdefghijab" || m.Description != "测试商户" {
+		t.Errorf("merchant = %s %s", m.APIV3Key, m.Description)
+	}
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListProfitSharingOrders 获取分账单列表 (含各接收方分账结果)
+func ListProfitSharingOrders(c *gin.Context) {
+	var orders []model.ProfitSharingOrder
+	query := core.DB.Preload("Receivers").Order("created_at desc")
+
+	if mchid := c.Query("mchid"); mchid != "" {
+		query = query.Where("mch_id = ?", mchid)
+	}
+	if transactionID := c.Query("transaction_id"); transactionID != "" {
+		query = query.Where("transaction_id = ?", transactionID)
+	}
+	if outOrderNo := c.Query("out_order_no"); outOrderNo != "" {
+		query = query.Where("out_order_no LIKE ?", "%"+outOrderNo+"%")
+	}
+
+	if result := query.Find(&orders); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// ListProfitSharingReceivers 获取分账接收方列表
+func ListProfitSharingReceivers(c *gin.Context) {
+	var receivers []model.ProfitSharingReceiver
+	query := core.DB.Order("created_at desc")
+
+	if mchid := c.Query("mchid"); mchid != "" {
+		query = query.Where("mch_id = ?", mchid)
+	}
+
+	if result := query.Find(&receivers); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, receivers)
+}
+
+// ListProfitSharingReturns 获取分账回退单列表
+func ListProfitSharingReturns(c *gin.Context) {
+	var returns []model.ProfitSharingReturn
+	query := core.DB.Order("created_at desc")
+
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	if result := query.Find(&returns); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, returns)
+}
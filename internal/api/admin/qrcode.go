@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QRCode 将任意文本 (如 Native 支付 code_url) 渲染为 PNG 二维码
+func QRCode(c *gin.Context) {
+	text := c.Query("text")
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+	if err != nil || size < 64 || size > 1024 {
+		size = 256
+	}
+
+	png, err := qrcode.Encode(text, qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", png)
+}
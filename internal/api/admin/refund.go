@@ -1,11 +1,10 @@
 package admin
 
 import (
-	"fmt"
 	"net/http"
-	"time"
 	"wepay-sandbox/internal/core"
 	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
 	"wepay-sandbox/internal/worker"
 
 	"github.com/gin-gonic/gin"
@@ -31,58 +30,17 @@ func SimulateRefund(c *gin.Context) {
 		return
 	}
 
-	if tx.Status != "SUCCESS" && tx.Status != "REFUND" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order status is not SUCCESS or REFUND"})
+	// 2. 创建退款并触发回调
+	refund, err := service.CreateRefund(tx, service.RefundParams{
+		Amount: input.Amount,
+		Reason: input.Reason,
+	})
+	if err != nil {
+		status, _, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"error": message})
 		return
 	}
 
-	// 2. 校验金额 (简化逻辑：不严格校验累计退款是否超额)
-	if input.Amount > tx.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount exceeds total amount"})
-		return
-	}
-
-	// 3. 获取商户退款配置
-	var mch model.Merchant
-	var notifyUrl string
-	if core.DB.Where("mch_id = ?", tx.MchID).First(&mch).Error == nil {
-		notifyUrl = mch.RefundNotifyUrl
-		if notifyUrl == "" {
-			notifyUrl = mch.NotifyUrl // Fallback
-		}
-	}
-
-	// 4. 创建退款记录
-	refundID := fmt.Sprintf("REF_%d", time.Now().UnixNano())
-	outRefundNo := fmt.Sprintf("REF_OUT_%d", time.Now().UnixNano())
-
-	refund := model.Refund{
-		RefundID:      refundID,
-		OutRefundNo:   outRefundNo,
-		TransactionID: tx.TransactionID,
-		MchID:         tx.MchID,
-		Amount:        input.Amount,
-		Total:         tx.Amount,
-		Currency:      tx.Currency,
-		Reason:        input.Reason,
-		Status:        "SUCCESS", // 模拟直接成功
-		NotifyUrl:     notifyUrl,
-	}
-
-	if err := core.DB.Create(&refund).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// 5. 更新原订单状态 (标记为 REFUND)
-	if tx.Status != "REFUND" {
-		tx.Status = "REFUND"
-		core.DB.Save(&tx)
-	}
-
-	// 6. 触发退款回调
-	worker.TriggerRefundCallback(refund)
-
 	c.JSON(http.StatusOK, refund)
 }
 
@@ -135,6 +93,26 @@ func RetryRefundCallback(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Retry task submitted"})
 }
 
+// CompleteRefund 手动推进处理中的退款 (SUCCESS / ABNORMAL / CLOSED)
+func CompleteRefund(c *gin.Context) {
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refund, err := service.CompleteRefund(c.Param("refund_id"), input.Status)
+	if err != nil {
+		status, _, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
 // DeleteRefunds 批量删除退款记录 (硬删除)
 func DeleteRefunds(c *gin.Context) {
 	var ids []uint
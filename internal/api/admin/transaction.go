@@ -2,8 +2,11 @@ package admin
 
 import (
 	"net/http"
+	"time"
 	"wepay-sandbox/internal/core"
 	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+	"wepay-sandbox/internal/tradestate"
 	"wepay-sandbox/internal/worker"
 
 	"github.com/gin-gonic/gin"
@@ -19,9 +22,10 @@ func ListTransactions(c *gin.Context) {
 		query = query.Where("mch_id = ?", mchid)
 	}
 
-	// 2. Prepay ID 精确查询
+	// 2. Prepay ID 精确查询 (合单预支付ID返回全部子单)
 	if prepayID := c.Query("prepay_id"); prepayID != "" {
-		query = query.Where("prepay_id = ?", prepayID)
+		combineIDs := core.DB.Model(&model.CombineOrder{}).Select("id").Where("prepay_id = ?", prepayID)
+		query = query.Where("prepay_id = ? OR combine_id IN (?)", prepayID, combineIDs)
 	}
 
 	// 3. 商户订单号模糊查询
@@ -36,6 +40,10 @@ func ListTransactions(c *gin.Context) {
 
 	// 5. 支付类型筛选
 	if tradeType := c.Query("trade_type"); tradeType != "" {
+		if !model.IsValidTradeType(tradeType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid trade_type"})
+			return
+		}
 		query = query.Where("trade_type = ?", tradeType)
 	}
 
@@ -52,9 +60,50 @@ func ListTransactions(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+
+	// 7. 合单子单展示合单的预支付ID
+	combinePrepayIDs(transactions)
+
+	// 8. 计算累计退款及剩余可退金额
+	ids := make([]string, 0, len(transactions))
+	for _, tx := range transactions {
+		ids = append(ids, tx.TransactionID)
+	}
+	refunded := service.RefundedAmounts(ids)
+	for i := range transactions {
+		transactions[i].RefundedAmount = refunded[transactions[i].TransactionID]
+		if transactions[i].Status == tradestate.Success || transactions[i].Status == tradestate.Refund {
+			transactions[i].RefundableAmount = transactions[i].Amount - transactions[i].RefundedAmount
+		}
+	}
 	c.JSON(http.StatusOK, transactions)
 }
 
+// combinePrepayIDs 为合单子单填充所属合单的预支付ID (子单本身不保存)
+func combinePrepayIDs(transactions []model.Transaction) {
+	var combineIDs []uint
+	for _, tx := range transactions {
+		if tx.CombineID != 0 && tx.PrepayID == "" {
+			combineIDs = append(combineIDs, tx.CombineID)
+		}
+	}
+	if len(combineIDs) == 0 {
+		return
+	}
+
+	var orders []model.CombineOrder
+	core.DB.Select("id", "prepay_id").Where("id IN ?", combineIDs).Find(&orders)
+	prepayIDs := map[uint]string{}
+	for _, order := range orders {
+		prepayIDs[order.ID] = order.PrepayID
+	}
+	for i := range transactions {
+		if transactions[i].CombineID != 0 && transactions[i].PrepayID == "" {
+			transactions[i].PrepayID = prepayIDs[transactions[i].CombineID]
+		}
+	}
+}
+
 // DeleteTransactions 批量删除交易记录 (硬删除)
 func DeleteTransactions(c *gin.Context) {
 	var ids []uint
@@ -82,25 +131,76 @@ func DeleteTransactions(c *gin.Context) {
 }
 
 // SimulatePay 模拟支付成功（手动触发）
+// 付款码订单 (USERPAYING) 可传 result=PAYERROR 模拟用户支付失败
 func SimulatePay(c *gin.Context) {
 	var input struct {
 		PrepayID string `json:"prepay_id" binding:"required"`
+		Result   string `json:"result"` // SUCCESS (默认), PAYERROR
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var tx model.Transaction
-	if result := core.DB.Where("prepay_id = ?", input.PrepayID).First(&tx); result.Error != nil {
+	txs, err := service.FindByPrepayID(input.PrepayID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
+	tx := txs[0]
+
+	if tx.Status == tradestate.Revoked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已撤销"})
+		return
+	}
+	if tx.Status == tradestate.Closed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已关闭"})
+		return
+	}
+
+	// 超过 time_expire 的订单不可支付 (定时任务尚未关闭时在此关闭)
+	if err := service.CloseExpiredOrder(tx); err != nil {
+		status, _, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if input.Result == "PAYERROR" {
+		if err := tradestate.Transit(&tx, tradestate.PayError); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "仅用户支付中的订单可模拟支付失败"})
+			return
+		}
+		// 按原状态条件更新，避免覆盖并发的关单或撤销
+		if !updateStatus(c, tx.ID, tradestate.PayError, map[string]interface{}{"status": tradestate.PayError}) {
+			return
+		}
+		core.DB.First(&tx, tx.ID)
+		c.JSON(http.StatusOK, tx)
+		return
+	}
+
+	// 合单子单：合单下全部子单一起支付
+	if tx.CombineID != 0 {
+		order, err := service.PayCombineOrder(tx.CombineID)
+		if err != nil {
+			_, _, message := service.ErrorDetail(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		c.JSON(http.StatusOK, order)
+		return
+	}
 
 	// 更新状态
-	if tx.Status != "SUCCESS" {
-		tx.Status = "SUCCESS"
-		core.DB.Save(&tx)
+	if tx.Status != tradestate.Success {
+		if err := tradestate.Transit(&tx, tradestate.Success); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !updateStatus(c, tx.ID, tradestate.Success, map[string]interface{}{"status": tradestate.Success, "paid_at": time.Now()}) {
+			return
+		}
+		core.DB.First(&tx, tx.ID)
 		// 触发回调任务
 		worker.TriggerCallback(tx)
 	}
@@ -108,11 +208,36 @@ func SimulatePay(c *gin.Context) {
 	c.JSON(http.StatusOK, tx)
 }
 
+// updateStatus 按可流转到 to 的状态条件更新订单，订单状态已变更 (如并发关单) 时写入错误响应并返回 false
+func updateStatus(c *gin.Context, id uint, to string, updates map[string]interface{}) bool {
+	result := core.DB.Model(&model.Transaction{}).Where("id = ? AND status IN ?", id, tradestate.Sources(to)).Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单状态已变更，请重新查询"})
+		return false
+	}
+	return true
+}
+
 // GetTransactionLogs 获取交易回调日志
 func GetTransactionLogs(c *gin.Context) {
 	transactionID := c.Param("transaction_id")
+
+	// 合单子单的回调以合单商户号及合单商户订单号记录
+	keys := []string{transactionID}
+	var tx model.Transaction
+	if core.DB.Where("transaction_id = ?", transactionID).First(&tx).Error == nil && tx.CombineID != 0 {
+		var order model.CombineOrder
+		if core.DB.First(&order, tx.CombineID).Error == nil {
+			keys = append(keys, worker.CombineCallbackKey(order))
+		}
+	}
+
 	var logs []model.CallbackLog
-	if result := core.DB.Where("transaction_id = ?", transactionID).Order("created_at desc").Find(&logs); result.Error != nil {
+	if result := core.DB.Where("transaction_id IN ?", keys).Order("created_at desc").Find(&logs); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
@@ -128,8 +253,17 @@ func RetryTransactionCallback(c *gin.Context) {
 		return
 	}
 
-	// 触发回调
-	worker.TriggerCallback(tx)
+	// 触发回调 (合单子单重发合单通知)
+	if tx.CombineID != 0 {
+		var order model.CombineOrder
+		if result := core.DB.First(&order, tx.CombineID); result.Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Combine order not found"})
+			return
+		}
+		worker.TriggerCombineCallback(order)
+	} else {
+		worker.TriggerCallback(tx)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Retry task submitted"})
 }
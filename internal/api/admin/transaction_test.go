@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetTransactionLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+
+	// 不同合单商户使用相同的合单商户订单号
+	for _, mchid := range []string{"100", "200"} {
+		order := model.CombineOrder{
+			CombineMchID:      mchid,
+			CombineOutTradeNo: "COMBINE_1",
+			SubOrders:         []model.Transaction{{MchID: mchid, OutTradeNo: "SUB_1", TransactionID: "4200" + mchid}},
+		}
+		core.DB.Create(&order)
+		core.DB.Create(&model.CallbackLog{TransactionID: worker.CombineCallbackKey(order), NotifyUrl: "https://" + mchid + ".example.com/notify"})
+	}
+	core.DB.Create(&model.CallbackLog{TransactionID: "4200100", NotifyUrl: "https://100.example.com/sub"})
+
+	r := gin.New()
+	r.GET("/transactions/:transaction_id/logs", GetTransactionLogs)
+
+	tests := []struct {
+		transactionID string
+		wantUrls      map[string]bool
+	}{
+		{"4200100", map[string]bool{"https://100.example.com/notify": true, "https://100.example.com/sub": true}},
+		{"4200200", map[string]bool{"https://200.example.com/notify": true}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/"+tt.transactionID+"/logs", nil))
+		var logs []model.CallbackLog
+		if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil {
+			t.Fatalf("%s: invalid response %q", tt.transactionID, w.Body.String())
+		}
+		got := map[string]bool{}
+		for _, log := range logs {
+			got[log.NotifyUrl] = true
+		}
+		if len(got) != len(tt.wantUrls) || len(logs) != len(tt.wantUrls) {
+			t.Errorf("%s: logs = %v, want %v", tt.transactionID, got, tt.wantUrls)
+			continue
+		}
+		for url := range tt.wantUrls {
+			if !got[url] {
+				t.Errorf("%s: missing log %s, got %v", tt.transactionID, url, got)
+			}
+		}
+	}
+}
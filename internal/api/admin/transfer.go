@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTransferBatches 获取商家转账批次列表 (含转账明细)
+func ListTransferBatches(c *gin.Context) {
+	var batches []model.TransferBatch
+	query := core.DB.Preload("Details").Order("created_at desc")
+
+	if mchid := c.Query("mchid"); mchid != "" {
+		query = query.Where("mch_id = ?", mchid)
+	}
+	if outBatchNo := c.Query("out_batch_no"); outBatchNo != "" {
+		query = query.Where("out_batch_no LIKE ?", "%"+outBatchNo+"%")
+	}
+	if status := c.Query("batch_status"); status != "" {
+		query = query.Where("batch_status = ?", status)
+	}
+
+	if result := query.Find(&batches); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, batches)
+}
+
+// GetTransferBatchLogs 获取转账批次回调日志
+func GetTransferBatchLogs(c *gin.Context) {
+	var logs []model.CallbackLog
+	if result := core.DB.Where("transaction_id = ?", c.Param("batch_id")).Order("created_at desc").Find(&logs); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// CompleteTransferDetail 手动推进处理中的转账明细 (SUCCESS / FAIL)
+func CompleteTransferDetail(c *gin.Context) {
+	var input struct {
+		Status     string `json:"status" binding:"required"`
+		FailReason string `json:"fail_reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	detail, err := service.CompleteTransferDetail(c.Param("detail_id"), input.Status, input.FailReason)
+	if err != nil {
+		status, _, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
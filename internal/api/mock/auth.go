@@ -0,0 +1,217 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// authSchema 微信支付 V3 认证类型
+	authSchema = "WECHATPAY2-SHA256-RSA2048"
+	// authTimestampWindow 请求时间戳允许的最大偏差
+	authTimestampWindow = 5 * time.Minute
+)
+
+// authParamPattern 解析 Authorization 头中的 key="value" 参数
+var authParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseAuthorization 解析 Authorization 头，返回认证类型及参数
+func parseAuthorization(header string) (string, map[string]string) {
+	params := map[string]string{}
+	schema, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	for _, m := range authParamPattern.FindAllStringSubmatch(rest, -1) {
+		params[m[1]] = m[2]
+	}
+	return schema, params
+}
+
+// requestMchID 获取请求方商户号：优先解析 Authorization 头，其次取 Query 参数 mchid (服务商模式为 sp_mchid)
+func requestMchID(c *gin.Context) string {
+	if _, params := parseAuthorization(c.GetHeader("Authorization")); params["mchid"] != "" {
+		return params["mchid"]
+	}
+	if mchid := c.Query("mchid"); mchid != "" {
+		return mchid
+	}
+	return c.Query("sp_mchid")
+}
+
+// readBody 读取并回填请求 Body，供签名处理及后续 Handler 使用
+func readBody(c *gin.Context) []byte {
+	if c.Request.Body == nil {
+		return nil
+	}
+	body, _ := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+// requestMchIDs 请求中出现的全部商户号，即各 Handler 可能据以确定商户的来源：
+// Body 中的 mchid/sp_mchid/combine_mchid、Query 参数 mchid/sp_mchid 及 Authorization 头中的 mchid (去重)
+func requestMchIDs(c *gin.Context, body []byte) []string {
+	var req struct {
+		MchID        string `json:"mchid"`
+		SpMchID      string `json:"sp_mchid"`
+		CombineMchID string `json:"combine_mchid"`
+	}
+	json.Unmarshal(body, &req)
+	_, params := parseAuthorization(c.GetHeader("Authorization"))
+
+	var mchids []string
+	seen := map[string]bool{}
+	for _, mchid := range []string{req.MchID, req.SpMchID, req.CombineMchID, c.Query("mchid"), c.Query("sp_mchid"), params["mchid"]} {
+		if mchid != "" && !seen[mchid] {
+			seen[mchid] = true
+			mchids = append(mchids, mchid)
+		}
+	}
+	return mchids
+}
+
+// resolveMchID 确定请求方商户 (用于应答签名)：Authorization 头 > Body > Query
+func resolveMchID(c *gin.Context, body []byte) string {
+	if _, params := parseAuthorization(c.GetHeader("Authorization")); params["mchid"] != "" {
+		return params["mchid"]
+	}
+	if mchids := requestMchIDs(c, body); len(mchids) > 0 {
+		return mchids[0]
+	}
+	return ""
+}
+
+// VerifySignature 严格模式签名校验中间件
+// 请求中出现的任一商户 (见 requestMchIDs) 开启 strict_sign 时，校验 Authorization 头中的 mchid 与该商户一致，
+// 并校验 nonce_str、timestamp、serial_no 及 signature；请求中无法确定商户且缺少 Authorization 头时，
+// 只要沙箱中存在严格模式商户即返回 SIGN_ERROR
+func VerifySignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := readBody(c)
+		schema, params := parseAuthorization(c.GetHeader("Authorization"))
+
+		mchids := requestMchIDs(c, body)
+		var strict []model.Merchant
+		for _, mchid := range mchids {
+			if mch, ok := strictMerchant(mchid); ok {
+				strict = append(strict, mch)
+			}
+		}
+		if len(strict) == 0 {
+			// 无法确定商户且未携带 Authorization 时，不能排除请求的是严格模式商户
+			if len(mchids) > 0 || c.GetHeader("Authorization") != "" || !hasStrictMerchant() {
+				c.Next()
+				return
+			}
+			abortSignError(c, "Http头缺少Authorization或Authorization为空", "", "", "")
+			return
+		}
+
+		url := c.Request.URL.RequestURI()
+		if c.GetHeader("Authorization") == "" {
+			abortSignError(c, "Http头缺少Authorization或Authorization为空", "", "", "")
+			return
+		}
+
+		message := c.Request.Method + "\n" + url + "\n" + params["timestamp"] + "\n" + params["nonce_str"] + "\n" + string(body) + "\n"
+
+		if schema != authSchema {
+			abortSignError(c, "错误的签名类型", "schema", "unsupported authorization schema", message)
+			return
+		}
+		for _, mch := range strict {
+			if params["mchid"] != mch.MchID {
+				abortSignError(c, "Authorization中的mchid与请求商户号不一致", "mchid", "mchid not match", message)
+				return
+			}
+		}
+		mch := strict[0]
+		if params["nonce_str"] == "" {
+			abortSignError(c, "Authorization中缺少nonce_str", "nonce_str", "nonce_str is empty", message)
+			return
+		}
+
+		ts, err := strconv.ParseInt(params["timestamp"], 10, 64)
+		if err != nil {
+			abortSignError(c, "Authorization中的timestamp格式错误", "timestamp", "invalid timestamp", message)
+			return
+		}
+		if d := time.Since(time.Unix(ts, 0)); d > authTimestampWindow || d < -authTimestampWindow {
+			abortSignError(c, "Authorization中的timestamp与系统时间相差过大", "timestamp", "timestamp expired", message)
+			return
+		}
+
+		pub, certSerial, err := core.ParseRSAPublicKey(mch.ClientCert)
+		if err != nil {
+			abortSignError(c, "商户未在沙箱中配置API证书", "serial_no", err.Error(), message)
+			return
+		}
+		serial := mch.ClientSerialNo
+		if serial == "" {
+			serial = certSerial
+		}
+		if !strings.EqualFold(params["serial_no"], serial) {
+			abortSignError(c, "商户证书序列号有误。请使用签名私钥匹配的证书序列号", "serial_no", "serial_no not match", message)
+			return
+		}
+
+		if err := core.VerifySHA256RSA(pub, message, params["signature"]); err != nil {
+			abortSignError(c, "签名错误", "signature", "sign not match", message)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// strictMerchant 查询商户及其是否开启严格模式签名校验
+func strictMerchant(mchid string) (model.Merchant, bool) {
+	var mch model.Merchant
+	if mchid == "" || core.DB.Where("mch_id = ?", mchid).First(&mch).Error != nil {
+		return mch, false
+	}
+	return mch, mch.StrictSign
+}
+
+// hasStrictMerchant 沙箱中是否存在开启严格模式签名校验的商户
+func hasStrictMerchant() bool {
+	var count int64
+	core.DB.Model(&model.Merchant{}).Where("strict_sign = ?", true).Count(&count)
+	return count > 0
+}
+
+// abortSignError 返回与真实接口一致的 SIGN_ERROR 错误结构
+func abortSignError(c *gin.Context, message, field, issue, signMessage string) {
+	resp := gin.H{
+		"code":    "SIGN_ERROR",
+		"message": message,
+	}
+	if field != "" {
+		truncated := signMessage
+		if len(truncated) > 128 {
+			truncated = truncated[:128]
+		}
+		resp["detail"] = gin.H{
+			"field":    field,
+			"location": "authorization",
+			"detail": gin.H{
+				"issue": issue,
+			},
+			"sign_information": gin.H{
+				"method":                 c.Request.Method,
+				"url":                    c.Request.URL.RequestURI(),
+				"sign_message_length":    len(signMessage),
+				"truncated_sign_message": truncated,
+			},
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, resp)
+}
@@ -0,0 +1,139 @@
+package mock
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newClientCert 生成商户 API 证书 (自签名) 及私钥
+func newClientCert(t *testing.T, serial int64) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "sandbox merchant"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// authorization 按 V3 规范生成 Authorization 头
+func authorization(t *testing.T, key *rsa.PrivateKey, mchid, serial, method, url, body string, ts time.Time) string {
+	t.Helper()
+	nonce := core.RandomString(32)
+	timestamp := fmt.Sprint(ts.Unix())
+	hashed := sha256.Sum256([]byte(method + "\n" + url + "\n" + timestamp + "\n" + nonce + "\n" + body + "\n"))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		authSchema, mchid, nonce, base64.StdEncoding.EncodeToString(sig), timestamp, serial)
+}
+
+func TestVerifySignature(t *testing.T) {
+	setupTestDB(t)
+	key, cert := newClientCert(t, 0x1A2B3C)
+	otherKey, _ := newClientCert(t, 0x4D5E6F)
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100", StrictSign: true, ClientCert: cert})
+	core.DB.Create(&model.Merchant{AppID: "wx200", MchID: "200"})
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) }
+	r.POST("/v3/pay/transactions/jsapi", VerifySignature(), ok)
+	r.GET("/v3/refund/domestic/refunds/:out_refund_no", VerifySignature(), ok)
+
+	const jsapiURL = "/v3/pay/transactions/jsapi"
+	body100 := `{"mchid":"100","out_trade_no":"ORDER_000001"}`
+	body200 := `{"mchid":"200","out_trade_no":"ORDER_000001"}`
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		auth      string
+		wantField string // 为空且 wantErr 时表示缺少 Authorization
+		wantErr   bool
+	}{
+		{"valid signature", http.MethodPost, jsapiURL, body100,
+			authorization(t, key, "100", "1A2B3C", http.MethodPost, jsapiURL, body100, now), "", false},
+		{"lowercase serial_no", http.MethodPost, jsapiURL, body100,
+			authorization(t, key, "100", "1a2b3c", http.MethodPost, jsapiURL, body100, now), "", false},
+		{"tampered body", http.MethodPost, jsapiURL, body100,
+			authorization(t, key, "100", "1A2B3C", http.MethodPost, jsapiURL, `{"mchid":"100","out_trade_no":"ORDER_000002"}`, now), "signature", true},
+		{"signed by another key", http.MethodPost, jsapiURL, body100,
+			authorization(t, otherKey, "100", "1A2B3C", http.MethodPost, jsapiURL, body100, now), "signature", true},
+		{"wrong serial_no", http.MethodPost, jsapiURL, body100,
+			authorization(t, key, "100", "4D5E6F", http.MethodPost, jsapiURL, body100, now), "serial_no", true},
+		{"expired timestamp", http.MethodPost, jsapiURL, body100,
+			authorization(t, key, "100", "1A2B3C", http.MethodPost, jsapiURL, body100, now.Add(-10*time.Minute)), "timestamp", true},
+		{"missing header", http.MethodPost, jsapiURL, body100, "", "", true},
+		{"non-strict mchid in query", http.MethodPost, jsapiURL + "?mchid=200", body100, "", "", true},
+		{"signed as non-strict merchant", http.MethodPost, jsapiURL, body100,
+			authorization(t, otherKey, "200", "4D5E6F", http.MethodPost, jsapiURL, body100, now), "mchid", true},
+		{"non-strict merchant without header", http.MethodPost, jsapiURL, body200, "", "", false},
+		{"no merchant in request", http.MethodGet, "/v3/refund/domestic/refunds/REFUND_1", "", "", "", true},
+		{"non-strict merchant in query", http.MethodGet, "/v3/refund/domestic/refunds/REFUND_1?mchid=200", "", "", "", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		r.ServeHTTP(w, req)
+
+		if !tt.wantErr {
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: response = %d %s, want 200", tt.name, w.Code, w.Body.String())
+			}
+			continue
+		}
+		var resp struct {
+			Code   string `json:"code"`
+			Detail struct {
+				Field string `json:"field"`
+			} `json:"detail"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusUnauthorized || resp.Code != "SIGN_ERROR" || resp.Detail.Field != tt.wantField {
+			t.Errorf("%s: response = %d %s, want 401 SIGN_ERROR on %q", tt.name, w.Code, w.Body.String(), tt.wantField)
+		}
+	}
+
+	// 沙箱中没有严格模式商户时不要求 Authorization
+	core.DB.Model(&model.Merchant{}).Where("mch_id = ?", "100").Update("strict_sign", false)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v3/refund/domestic/refunds/REFUND_1", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("no strict merchant: response = %d %s, want 200", w.Code, w.Body.String())
+	}
+}
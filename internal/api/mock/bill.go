@@ -0,0 +1,80 @@
+package mock
+
+import (
+	"net/http"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TradeBill 申请交易账单
+func TradeBill(c *gin.Context) {
+	mchid, ok := billMerchant(c)
+	if !ok {
+		return
+	}
+
+	content, err := service.TradeBill(mchid, c.Query("sub_mchid"), c.Query("bill_date"), c.Query("bill_type"))
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+	respondBillDownload(c, content)
+}
+
+// FundFlowBill 申请资金账单
+func FundFlowBill(c *gin.Context) {
+	mchid, ok := billMerchant(c)
+	if !ok {
+		return
+	}
+
+	content, err := service.FundFlowBill(mchid, c.Query("bill_date"), c.Query("account_type"))
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+	respondBillDownload(c, content)
+}
+
+// DownloadBill 下载账单文件 (申请账单接口返回的 download_url)
+func DownloadBill(c *gin.Context) {
+	content, ok := service.BillDownload(c.Query("token"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "下载链接不存在或已过期"})
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", content)
+}
+
+// billMerchant 账单所属商户取自 Authorization/Query，失败时已写入错误响应
+func billMerchant(c *gin.Context) (string, bool) {
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return "", false
+	}
+	if sub := c.Query("sub_mchid"); sub != "" && !checkPartnerRelation(c, mchid, sub) {
+		return "", false
+	}
+	return mchid, true
+}
+
+// respondBillDownload 保存账单文件并返回下载地址及原始账单摘要
+func respondBillDownload(c *gin.Context, content []byte) {
+	token, hashValue, err := service.SaveBillDownload(content, c.Query("tar_type"))
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hash_type":    "SHA1",
+		"hash_value":   hashValue,
+		"download_url": core.PublicBaseURL(c.Request) + "/v3/billdownload/file?token=" + token,
+	})
+}
@@ -0,0 +1,59 @@
+package mock
+
+import (
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadCertificates 下载平台证书
+func DownloadCertificates(c *gin.Context) {
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    "PARAM_ERROR",
+			"message": "mchid is required",
+		})
+		return
+	}
+
+	var mch model.Merchant
+	if result := core.DB.Where("mch_id = ?", mchid).First(&mch); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return
+	}
+
+	certs, err := core.ListPlatformCerts(mch.MchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+		return
+	}
+
+	data := make([]map[string]interface{}, 0, len(certs))
+	for _, cert := range certs {
+		// 证书内容使用商户 APIv3 密钥加密
+		nonce := core.RandomString(12)
+		ciphertext, err := core.EncryptAESGCM(mch.APIV3Key, nonce, "certificate", []byte(cert.Certificate))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+			return
+		}
+
+		data = append(data, map[string]interface{}{
+			"serial_no":      cert.SerialNo,
+			"effective_time": cert.EffectiveTime.Format(time.RFC3339),
+			"expire_time":    cert.ExpireTime.Format(time.RFC3339),
+			"encrypt_certificate": map[string]interface{}{
+				"algorithm":       "AEAD_AES_256_GCM",
+				"nonce":           nonce,
+				"associated_data": "certificate",
+				"ciphertext":      ciphertext,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"wepay-sandbox/internal/core"
 	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,22 +34,64 @@ func CloseOrder(c *gin.Context) {
 		return
 	}
 
-	if tx.Status == "SUCCESS" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"code":    "ORDERPAID",
-			"message": "Order paid",
+	if tx.CombineID != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": "合单子单请使用合单关单接口",
 		})
 		return
 	}
 
-	if tx.Status == "CLOSED" {
-		c.Status(http.StatusNoContent)
+	closeOrder(c, tx)
+}
+
+// closeOrder 关闭单笔订单：按可关闭状态条件更新，避免覆盖并发的支付结果；
+// 订单状态已变更时按最新状态应答
+func closeOrder(c *gin.Context, tx model.Transaction) {
+	if respondUnclosable(c, tx.Status) {
 		return
 	}
 
-	// 更新状态为 CLOSED
-	tx.Status = "CLOSED"
-	core.DB.Save(&tx)
+	result := core.DB.Model(&model.Transaction{}).Where("id = ? AND status IN ?", tx.ID, tradestate.Sources(tradestate.Closed)).
+		Update("status", tradestate.Closed)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    "SYSTEM_ERROR",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		core.DB.First(&tx, tx.ID)
+		if !respondUnclosable(c, tx.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "订单状态已变更，请重新查询",
+			})
+		}
+		return
+	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// respondUnclosable 订单已支付、已关闭或不可关闭时写入应答并返回 true
+func respondUnclosable(c *gin.Context, status string) bool {
+	switch {
+	case status == tradestate.Success || status == tradestate.Refund:
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    "ORDERPAID",
+			"message": "Order paid",
+		})
+	case status == tradestate.Closed:
+		c.Status(http.StatusNoContent)
+	case !tradestate.CanTransit(status, tradestate.Closed):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": (&tradestate.TransitionError{From: status, To: tradestate.Closed}).Error(),
+		})
+	default:
+		return false
+	}
+	return true
+}
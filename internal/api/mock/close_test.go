@@ -0,0 +1,60 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCloseOrder(t *testing.T) {
+	setupTestDB(t)
+
+	tests := []struct {
+		name       string
+		stored     string // 库中的订单状态
+		loaded     string // 关单时读取到的订单状态，与库中不同时模拟并发变更
+		wantStatus int
+		wantCode   string
+		wantState  string
+	}{
+		{"not paid", tradestate.NotPay, tradestate.NotPay, http.StatusNoContent, "", tradestate.Closed},
+		{"closed", tradestate.Closed, tradestate.Closed, http.StatusNoContent, "", tradestate.Closed},
+		{"paid", tradestate.Success, tradestate.Success, http.StatusForbidden, "ORDERPAID", tradestate.Success},
+		{"refund", tradestate.Refund, tradestate.Refund, http.StatusForbidden, "ORDERPAID", tradestate.Refund},
+		{"revoked", tradestate.Revoked, tradestate.Revoked, http.StatusBadRequest, "INVALID_REQUEST", tradestate.Revoked},
+		{"paid concurrently", tradestate.Success, tradestate.NotPay, http.StatusForbidden, "ORDERPAID", tradestate.Success},
+		{"closed concurrently", tradestate.Closed, tradestate.NotPay, http.StatusNoContent, "", tradestate.Closed},
+	}
+	for i, tt := range tests {
+		tx := model.Transaction{MchID: "100", OutTradeNo: "ORDER_" + tt.name, TransactionID: fmt.Sprintf("42000000%02d", i), Status: tt.stored}
+		core.DB.Create(&tx)
+		tx.Status = tt.loaded
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		closeOrder(c, tx)
+		c.Writer.WriteHeaderNow()
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if tt.wantCode != "" {
+			var resp map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["code"] != tt.wantCode {
+				t.Errorf("%s: code = %v, want %s", tt.name, resp["code"], tt.wantCode)
+			}
+		}
+		core.DB.First(&tx, tx.ID)
+		if tx.Status != tt.wantState {
+			t.Errorf("%s: trade_state = %s, want %s", tt.name, tx.Status, tt.wantState)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxCombineSubOrders 合单最多支持的子单数
+const maxCombineSubOrders = 50
+
+// CombineSubOrder 合单子单参数
+type CombineSubOrder struct {
+	Mchid       string     `json:"mchid"`
+	Attach      string     `json:"attach"`
+	OutTradeNo  string     `json:"out_trade_no"`
+	Description string     `json:"description"`
+	SettleInfo  SettleInfo `json:"settle_info"`
+	Amount      struct {
+		TotalAmount int64  `json:"total_amount"`
+		Currency    string `json:"currency"`
+	} `json:"amount"`
+}
+
+// CombinePrepayRequest 合单下单请求参数 (JSAPI/APP/H5/Native 共用)
+type CombinePrepayRequest struct {
+	CombineAppID      string            `json:"combine_appid"`
+	CombineMchid      string            `json:"combine_mchid"`
+	CombineOutTradeNo string            `json:"combine_out_trade_no"`
+	TimeExpire        string            `json:"time_expire"`
+	SceneInfo         json.RawMessage   `json:"scene_info"`
+	SubOrders         []CombineSubOrder `json:"sub_orders"`
+	CombinePayerInfo  struct {
+		OpenID string `json:"openid"`
+	} `json:"combine_payer_info"`
+	NotifyUrl string `json:"notify_url"`
+}
+
+// CombineJSAPIPrepay 合单 JSAPI 下单
+func CombineJSAPIPrepay(c *gin.Context) {
+	order, ok := createCombine(c, model.TradeTypeJSAPI)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prepay_id": order.PrepayID})
+}
+
+// CombineAppPrepay 合单 APP 下单
+func CombineAppPrepay(c *gin.Context) {
+	order, ok := createCombine(c, model.TradeTypeApp)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prepay_id": order.PrepayID})
+}
+
+// CombineNativePrepay 合单 Native 下单，code_url 与普通 Native 下单共用落地页
+func CombineNativePrepay(c *gin.Context) {
+	order, ok := createCombine(c, model.TradeTypeNative)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code_url": core.PublicBaseURL(c.Request) + "/pay/native/" + order.PrepayID})
+}
+
+// CombineH5Prepay 合单 H5 下单，h5_url 与普通 H5 下单共用中间页
+func CombineH5Prepay(c *gin.Context) {
+	order, ok := createCombine(c, model.TradeTypeMWeb)
+	if !ok {
+		return
+	}
+	h5Url := core.PublicBaseURL(c.Request) + "/pay/h5?prepay_id=" + order.PrepayID + "&package=" + core.RandomString(10)
+	c.JSON(http.StatusOK, gin.H{"h5_url": h5Url})
+}
+
+// createCombine 合单下单公共逻辑：校验参数及商户，在同一事务内保存合单及全部子单；合单商户订单号已存在且参数一致时返回原合单
+// 失败时已写入错误响应，返回 false
+func createCombine(c *gin.Context, tradeType string) (model.CombineOrder, bool) {
+	var order model.CombineOrder
+
+	var req CombinePrepayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return order, false
+	}
+
+	if !validateCombine(c, req, tradeType) {
+		return order, false
+	}
+
+	// 校验合单商户及子单商户
+	var mch model.Merchant
+	if result := core.DB.Where("mch_id = ?", req.CombineMchid).First(&mch); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return order, false
+	}
+	if !checkAppIDBinding(c, req.CombineAppID, req.CombineMchid) {
+		return order, false
+	}
+	for _, sub := range req.SubOrders {
+		var subMch model.Merchant
+		if result := core.DB.Where("mch_id = ?", sub.Mchid).First(&subMch); result.Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "子单商户号 " + sub.Mchid + " 未在沙箱配置"})
+			return order, false
+		}
+	}
+
+	// 同一合单商户订单号重复下单：参数一致时返回原合单
+	var existing model.CombineOrder
+	err := core.DB.Preload("SubOrders").Where("combine_out_trade_no = ? AND combine_mch_id = ?", req.CombineOutTradeNo, req.CombineMchid).First(&existing).Error
+	if err == nil {
+		return existing, reuseCombine(c, existing, req, tradeType)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+		return order, false
+	}
+	for _, sub := range req.SubOrders {
+		var count int64
+		core.DB.Model(&model.Transaction{}).Where("out_trade_no = ? AND mch_id = ?", sub.OutTradeNo, sub.Mchid).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "子单商户订单号 " + sub.OutTradeNo + " 已存在"})
+			return order, false
+		}
+	}
+
+	expireAt, ok := parseTimeExpire(c, req.TimeExpire)
+	if !ok {
+		return order, false
+	}
+
+	order = model.CombineOrder{
+		CombineAppID:      req.CombineAppID,
+		CombineMchID:      req.CombineMchid,
+		CombineOutTradeNo: req.CombineOutTradeNo,
+		PrepayID:          fmt.Sprintf("wx%s%06d", time.Now().Format("20060102150405"), rand.Intn(100000)),
+		TradeType:         tradeType,
+		PayerOpenID:       req.CombinePayerInfo.OpenID,
+		NotifyUrl:         req.NotifyUrl,
+		Status:            tradestate.NotPay,
+		TimeExpire:        &expireAt,
+	}
+	if len(req.SceneInfo) > 0 {
+		order.SceneInfo = string(req.SceneInfo)
+	}
+
+	// 子单不单独生成预支付ID，按合单的预支付ID整单支付；子单微信支付订单号以序号后缀保证唯一
+	idPrefix := fmt.Sprintf("420000%s%04d", time.Now().Format("20060102150405"), rand.Intn(10000))
+	for i, sub := range req.SubOrders {
+		currency := sub.Amount.Currency
+		if currency == "" {
+			currency = "CNY"
+		}
+		order.SubOrders = append(order.SubOrders, model.Transaction{
+			AppID:         req.CombineAppID,
+			MchID:         sub.Mchid,
+			Description:   sub.Description,
+			OutTradeNo:    sub.OutTradeNo,
+			TransactionID: fmt.Sprintf("%s%02d", idPrefix, i),
+			Attach:        sub.Attach,
+			Amount:        sub.Amount.TotalAmount,
+			Currency:      currency,
+			PayerOpenID:   req.CombinePayerInfo.OpenID,
+			Status:        tradestate.NotPay,
+			NotifyUrl:     req.NotifyUrl,
+			TradeType:     tradeType,
+			TimeExpire:    &expireAt,
+			ProfitSharing: sub.SettleInfo.ProfitSharing,
+		})
+	}
+
+	err = core.DB.Transaction(func(db *gorm.DB) error {
+		return db.Create(&order).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+		return order, false
+	}
+
+	return order, true
+}
+
+// validateCombine 校验合单下单参数 (含 H5 场景信息及全部子单)，失败时已写入错误响应
+func validateCombine(c *gin.Context, req CombinePrepayRequest, tradeType string) bool {
+	var p paramChecker
+	p.str("/combine_appid", req.CombineAppID, 1, 32)
+	p.str("/combine_mchid", req.CombineMchid, 1, 32)
+	p.outTradeNo("/combine_out_trade_no", req.CombineOutTradeNo)
+	p.notifyUrl(req.NotifyUrl, relaxedNotifyUrl(req.CombineMchid))
+	if tradeType == model.TradeTypeJSAPI {
+		p.str("/combine_payer_info/openid", req.CombinePayerInfo.OpenID, 1, 128)
+	}
+	if len(req.SubOrders) == 0 || len(req.SubOrders) > maxCombineSubOrders {
+		p.fail("/sub_orders", len(req.SubOrders), fmt.Sprintf("子单数量须为 1-%d 笔", maxCombineSubOrders))
+	}
+
+	seen := map[string]bool{}
+	for i, sub := range req.SubOrders {
+		field := fmt.Sprintf("/sub_orders/%d", i)
+		p.str(field+"/mchid", sub.Mchid, 1, 32)
+		p.outTradeNo(field+"/out_trade_no", sub.OutTradeNo)
+		p.str(field+"/description", sub.Description, 1, 127)
+		p.str(field+"/attach", sub.Attach, 0, 128)
+		if sub.Amount.TotalAmount < 1 {
+			p.fail(field+"/amount/total_amount", sub.Amount.TotalAmount, "值低于最小值 1")
+		}
+		if sub.Amount.Currency != "" && sub.Amount.Currency != "CNY" {
+			p.fail(field+"/amount/currency", sub.Amount.Currency, "仅支持 CNY")
+		}
+		// 商户订单号在子单商户内唯一，不同子单商户可使用相同单号
+		key := sub.Mchid + "/" + sub.OutTradeNo
+		if seen[key] {
+			p.fail(field+"/out_trade_no", sub.OutTradeNo, "同一子单商户的商户订单号重复")
+		}
+		seen[key] = true
+	}
+	if !p.ok(c) {
+		return false
+	}
+
+	return tradeType != model.TradeTypeMWeb || checkH5SceneInfo(c, req.SceneInfo)
+}
+
+// reuseCombine 合单重复下单时校验原合单状态及下单参数，可返回原合单时为 true；否则已写入错误响应
+func reuseCombine(c *gin.Context, existing model.CombineOrder, req CombinePrepayRequest, tradeType string) bool {
+	// 已过期但尚未被定时任务关闭的合单在此关闭
+	if service.CloseExpiredCombineOrder(existing) != nil {
+		existing.Status = tradestate.Closed
+	}
+	if !checkOrderReusable(c, existing.Status) {
+		return false
+	}
+
+	if !sameCombineParams(existing, req, tradeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "合单商户订单号重复，且下单参数与原合单不一致"})
+		return false
+	}
+	return true
+}
+
+// sameCombineParams 合单重复下单的参数 (含全部子单) 是否与原合单一致
+func sameCombineParams(existing model.CombineOrder, req CombinePrepayRequest, tradeType string) bool {
+	if existing.CombineAppID != req.CombineAppID || existing.TradeType != tradeType ||
+		existing.PayerOpenID != req.CombinePayerInfo.OpenID || existing.NotifyUrl != req.NotifyUrl ||
+		len(existing.SubOrders) != len(req.SubOrders) || !sameTimeExpire(existing.TimeExpire, req.TimeExpire) {
+		return false
+	}
+
+	subs := map[string]model.Transaction{}
+	for _, sub := range existing.SubOrders {
+		subs[sub.MchID+"/"+sub.OutTradeNo] = sub
+	}
+	for _, sub := range req.SubOrders {
+		currency := sub.Amount.Currency
+		if currency == "" {
+			currency = "CNY"
+		}
+		prev, ok := subs[sub.Mchid+"/"+sub.OutTradeNo]
+		if !ok || prev.Description != sub.Description || prev.Amount != sub.Amount.TotalAmount ||
+			prev.Currency != currency || prev.Attach != sub.Attach || prev.ProfitSharing != sub.SettleInfo.ProfitSharing {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryCombineOrder 合单查询 (合单商户订单号)
+func QueryCombineOrder(c *gin.Context) {
+	combineOutTradeNo := c.Param("combine_out_trade_no")
+
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return
+	}
+	query := core.DB.Preload("SubOrders").Where("combine_out_trade_no = ? AND combine_mch_id = ?", combineOutTradeNo, mchid)
+
+	var order model.CombineOrder
+	if result := query.First(&order); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "合单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCombineResponse(order))
+}
+
+// CloseCombineOrder 合单关单，合单下全部子单同时关闭
+func CloseCombineOrder(c *gin.Context) {
+	combineOutTradeNo := c.Param("combine_out_trade_no")
+
+	var req struct {
+		CombineAppID string `json:"combine_appid"`
+		SubOrders    []struct {
+			Mchid      string `json:"mchid"`
+			OutTradeNo string `json:"out_trade_no"`
+		} `json:"sub_orders"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "Invalid request body"})
+		return
+	}
+
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return
+	}
+	query := core.DB.Preload("SubOrders").Where("combine_out_trade_no = ? AND combine_mch_id = ?", combineOutTradeNo, mchid)
+
+	var order model.CombineOrder
+	if result := query.First(&order); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "ORDER_NOT_EXIST", "message": "Order not found"})
+		return
+	}
+
+	if req.CombineAppID != "" && req.CombineAppID != order.CombineAppID {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "combine_appid与合单不一致"})
+		return
+	}
+
+	// 请求中的子单必须属于该合单
+	subs := map[string]bool{}
+	for _, sub := range order.SubOrders {
+		subs[sub.MchID+"/"+sub.OutTradeNo] = true
+	}
+	for _, sub := range req.SubOrders {
+		if !subs[sub.Mchid+"/"+sub.OutTradeNo] {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "子单 " + sub.OutTradeNo + " 不属于该合单"})
+			return
+		}
+	}
+
+	if respondCombineUnclosable(c, order.Status) {
+		return
+	}
+
+	if err := service.CloseCombineOrder(order.ID); err != nil {
+		// 合单状态已变更 (如并发支付成功) 时按最新状态应答
+		if errors.Is(err, service.ErrCombineOrderChanged) {
+			core.DB.First(&order, order.ID)
+			if respondCombineUnclosable(c, order.Status) {
+				return
+			}
+		}
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondCombineUnclosable 合单已支付或已关闭时写入应答并返回 true
+func respondCombineUnclosable(c *gin.Context, status string) bool {
+	switch status {
+	case tradestate.Success:
+		c.JSON(http.StatusForbidden, gin.H{"code": "ORDERPAID", "message": "Order paid"})
+	case tradestate.Closed:
+		c.Status(http.StatusNoContent)
+	default:
+		return false
+	}
+	return true
+}
+
+// buildCombineResponse 构建合单查询响应结构
+func buildCombineResponse(order model.CombineOrder) map[string]interface{} {
+	subOrders := make([]map[string]interface{}, 0, len(order.SubOrders))
+	for _, sub := range order.SubOrders {
+		item := map[string]interface{}{
+			"mchid":          sub.MchID,
+			"trade_type":     sub.TradeType,
+			"trade_state":    sub.Status,
+			"bank_type":      "OTHERS",
+			"attach":         sub.Attach,
+			"transaction_id": sub.TransactionID,
+			"out_trade_no":   sub.OutTradeNo,
+			"amount": map[string]interface{}{
+				"total_amount":   sub.Amount,
+				"payer_amount":   sub.Amount,
+				"currency":       sub.Currency,
+				"payer_currency": sub.Currency,
+			},
+		}
+		if sub.PaidAt != nil {
+			item["success_time"] = sub.PaidAt.Format(time.RFC3339)
+		}
+		subOrders = append(subOrders, item)
+	}
+
+	resp := map[string]interface{}{
+		"combine_appid":        order.CombineAppID,
+		"combine_mchid":        order.CombineMchID,
+		"combine_out_trade_no": order.CombineOutTradeNo,
+		"sub_orders":           subOrders,
+		"combine_payer_info": map[string]interface{}{
+			"openid": order.PayerOpenID,
+		},
+	}
+
+	var sceneInfo map[string]interface{}
+	if json.Unmarshal([]byte(order.SceneInfo), &sceneInfo) == nil && sceneInfo != nil {
+		resp["scene_info"] = sceneInfo
+	}
+	return resp
+}
@@ -0,0 +1,124 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// H5PrepayRequest H5下单请求参数
+type H5PrepayRequest struct {
+	AppID       string     `json:"appid"`
+	Mchid       string     `json:"mchid"`
+	Description string     `json:"description"`
+	OutTradeNo  string     `json:"out_trade_no"`
+	TimeExpire  string     `json:"time_expire"`
+	NotifyUrl   string     `json:"notify_url"`
+	SettleInfo  SettleInfo `json:"settle_info"`
+	Amount      struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+	SceneInfo struct {
+		PayerClientIP string `json:"payer_client_ip"`
+		H5Info        *struct {
+			Type        string `json:"type"`
+			AppName     string `json:"app_name"`
+			AppUrl      string `json:"app_url"`
+			BundleID    string `json:"bundle_id"`
+			PackageName string `json:"package_name"`
+		} `json:"h5_info"`
+	} `json:"scene_info"`
+}
+
+// h5SceneTypes h5_info.type 允许的场景类型
+var h5SceneTypes = map[string]bool{"iOS": true, "Android": true, "Wap": true}
+
+// H5Prepay H5 下单接口，返回跳转至支付模拟页的 h5_url
+func H5Prepay(c *gin.Context) {
+	var req H5PrepayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	// 校验场景信息
+	var p paramChecker
+	h5Type := ""
+	if req.SceneInfo.H5Info != nil {
+		h5Type = req.SceneInfo.H5Info.Type
+	}
+	p.h5SceneInfo(req.SceneInfo.PayerClientIP, h5Type)
+	if !p.ok(c) {
+		return
+	}
+
+	tx, ok := createPrepay(c, model.Transaction{
+		AppID:         req.AppID,
+		MchID:         req.Mchid,
+		Description:   req.Description,
+		OutTradeNo:    req.OutTradeNo,
+		Amount:        req.Amount.Total,
+		Currency:      req.Amount.Currency,
+		NotifyUrl:     req.NotifyUrl,
+		TradeType:     model.TradeTypeMWeb,
+		ProfitSharing: req.SettleInfo.ProfitSharing,
+	}, req.TimeExpire)
+	if !ok {
+		return
+	}
+
+	h5Url := core.PublicBaseURL(c.Request) + "/pay/h5?prepay_id=" + tx.PrepayID + "&package=" + core.RandomString(10)
+	c.JSON(http.StatusOK, gin.H{"h5_url": h5Url})
+}
+
+// checkH5SceneInfo 校验合单、服务商 H5 下单的 scene_info，失败时已写入错误响应
+func checkH5SceneInfo(c *gin.Context, raw json.RawMessage) bool {
+	var scene struct {
+		PayerClientIP string `json:"payer_client_ip"`
+		H5Info        *struct {
+			Type string `json:"type"`
+		} `json:"h5_info"`
+	}
+	json.Unmarshal(raw, &scene)
+
+	var p paramChecker
+	h5Type := ""
+	if scene.H5Info != nil {
+		h5Type = scene.H5Info.Type
+	}
+	p.h5SceneInfo(scene.PayerClientIP, h5Type)
+	return p.ok(c)
+}
+
+// H5Redirect h5_url 中间页，携带商户追加的 redirect_url 跳转到前端支付模拟页
+func H5Redirect(c *gin.Context) {
+	prepayID := c.Query("prepay_id")
+
+	if _, err := service.FindByPrepayID(prepayID); err != nil {
+		c.String(http.StatusNotFound, "订单不存在或已失效")
+		return
+	}
+
+	target := core.WebBaseURL(c.Request) + "/pay/preview/" + prepayID
+	if redirectUrl := c.Query("redirect_url"); redirectUrl != "" {
+		if !isHTTPURL(redirectUrl) {
+			c.String(http.StatusBadRequest, "redirect_url须为http或https开头的完整地址")
+			return
+		}
+		target += "?redirect_url=" + url.QueryEscape(redirectUrl)
+	}
+
+	c.Redirect(http.StatusFound, target)
+}
+
+// isHTTPURL 是否为 http/https 协议的绝对地址，避免 redirect_url 跳转到 javascript: 等伪协议
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestH5Redirect(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Transaction{MchID: "100", OutTradeNo: "ORDER_000001", TransactionID: "4200000001", PrepayID: "wx_prepay_1", TradeType: model.TradeTypeMWeb, Status: tradestate.NotPay})
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantRedirect string // 跳转地址中的 redirect_url
+	}{
+		{"without redirect_url", "prepay_id=wx_prepay_1", http.StatusFound, ""},
+		{"https redirect_url", "prepay_id=wx_prepay_1&redirect_url=" + url.QueryEscape("https://example.com/result?id=1"), http.StatusFound, "https://example.com/result?id=1"},
+		{"http redirect_url", "prepay_id=wx_prepay_1&redirect_url=" + url.QueryEscape("http://localhost:8080/result"), http.StatusFound, "http://localhost:8080/result"},
+		{"javascript redirect_url", "prepay_id=wx_prepay_1&redirect_url=" + url.QueryEscape("javascript:alert(1)"), http.StatusBadRequest, ""},
+		{"scheme-relative redirect_url", "prepay_id=wx_prepay_1&redirect_url=" + url.QueryEscape("//evil.example.com"), http.StatusBadRequest, ""},
+		{"relative redirect_url", "prepay_id=wx_prepay_1&redirect_url=/result", http.StatusBadRequest, ""},
+		{"unknown prepay_id", "prepay_id=wx_unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/pay/h5?"+tt.query, nil)
+		H5Redirect(c)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.wantStatus)
+			continue
+		}
+		if w.Code != http.StatusFound {
+			continue
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil || !strings.HasSuffix(location.Path, "/pay/preview/wx_prepay_1") {
+			t.Errorf("%s: Location = %s", tt.name, w.Header().Get("Location"))
+			continue
+		}
+		if got := location.Query().Get("redirect_url"); got != tt.wantRedirect {
+			t.Errorf("%s: redirect_url = %q, want %q", tt.name, got, tt.wantRedirect)
+		}
+	}
+}
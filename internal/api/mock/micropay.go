@@ -0,0 +1,122 @@
+package mock
+
+import (
+	"net/http"
+	"regexp"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authCodePattern 付款码规则：18 位纯数字，以 10~15 开头
+var authCodePattern = regexp.MustCompile(`^1[0-5]\d{16}$`)
+
+// MicropayRequest 付款码支付请求参数
+type MicropayRequest struct {
+	AppID       string     `json:"appid"`
+	Mchid       string     `json:"mchid"`
+	Description string     `json:"description"`
+	OutTradeNo  string     `json:"out_trade_no"`
+	NotifyUrl   string     `json:"notify_url"`
+	SettleInfo  SettleInfo `json:"settle_info"`
+	AuthCode    string     `json:"auth_code"`
+	Amount      struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// Micropay 付款码支付
+// 订单以 USERPAYING 状态创建，等待用户在移动端模拟页 (或管理后台) 输入密码确认，商户需轮询查询订单结果
+func Micropay(c *gin.Context) {
+	var req MicropayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	if !authCodePattern.MatchString(req.AuthCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "AUTH_CODE_INVALID", "message": "付款码无效，请重新扫码"})
+		return
+	}
+
+	tx, ok := createPrepay(c, model.Transaction{
+		AppID:         req.AppID,
+		MchID:         req.Mchid,
+		Description:   req.Description,
+		OutTradeNo:    req.OutTradeNo,
+		Amount:        req.Amount.Total,
+		Currency:      req.Amount.Currency,
+		PayerOpenID:   "mock_openid_" + req.AuthCode[len(req.AuthCode)-6:],
+		Status:        tradestate.UserPaying,
+		NotifyUrl:     req.NotifyUrl,
+		TradeType:     model.TradeTypeMicropay,
+		ProfitSharing: req.SettleInfo.ProfitSharing,
+	}, "")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":           "USERPAYING",
+		"message":        "需要用户输入支付密码",
+		"out_trade_no":   tx.OutTradeNo,
+		"transaction_id": tx.TransactionID,
+		"prepay_id":      tx.PrepayID,
+		"trade_state":    tx.Status,
+	})
+}
+
+// ReverseOrder 撤销付款码订单
+// 用户支付中或支付失败的订单直接撤销；已支付的订单需调用申请退款接口退款
+func ReverseOrder(c *gin.Context) {
+	outTradeNo := c.Param("out_trade_no")
+
+	var req struct {
+		MchID string `json:"mchid"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "Invalid request body"})
+		return
+	}
+
+	var tx model.Transaction
+	if result := core.DB.Where("out_trade_no = ? AND mch_id = ?", outTradeNo, req.MchID).First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "ORDER_NOT_EXIST", "message": "Order not found"})
+		return
+	}
+
+	if tx.TradeType != model.TradeTypeMicropay {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "仅付款码支付订单可撤销"})
+		return
+	}
+
+	// 已支付订单的资金需通过申请退款接口退回，不能直接撤销
+	if tx.Status == tradestate.Success {
+		c.JSON(http.StatusForbidden, gin.H{"code": "INVALID_REQUEST", "message": "订单已支付，请调用申请退款接口退款"})
+		return
+	}
+
+	// 重复撤销直接返回
+	if tx.Status != tradestate.Revoked {
+		from := tx.Status
+		if err := tradestate.Transit(&tx, tradestate.Revoked); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"code": "INVALID_REQUEST", "message": "订单状态为 " + from + "，无法撤销"})
+			return
+		}
+		// 按原状态条件更新，避免覆盖并发的支付确认
+		if core.DB.Model(&tx).Where("status = ?", from).Update("status", tradestate.Revoked).RowsAffected == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"code": "INVALID_REQUEST", "message": "订单状态已变更，请重新查询"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recall":         false,
+		"out_trade_no":   tx.OutTradeNo,
+		"transaction_id": tx.TransactionID,
+		"trade_state":    tx.Status,
+	})
+}
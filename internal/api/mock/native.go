@@ -0,0 +1,63 @@
+package mock
+
+import (
+	"net/http"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NativePrepayRequest Native下单请求参数
+type NativePrepayRequest struct {
+	AppID       string     `json:"appid"`
+	Mchid       string     `json:"mchid"`
+	Description string     `json:"description"`
+	OutTradeNo  string     `json:"out_trade_no"`
+	TimeExpire  string     `json:"time_expire"`
+	NotifyUrl   string     `json:"notify_url"`
+	SettleInfo  SettleInfo `json:"settle_info"`
+	Amount      struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// NativePrepay Native 下单接口，返回可扫码打开支付模拟页的 code_url
+func NativePrepay(c *gin.Context) {
+	var req NativePrepayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	tx, ok := createPrepay(c, model.Transaction{
+		AppID:         req.AppID,
+		MchID:         req.Mchid,
+		Description:   req.Description,
+		OutTradeNo:    req.OutTradeNo,
+		Amount:        req.Amount.Total,
+		Currency:      req.Amount.Currency,
+		NotifyUrl:     req.NotifyUrl,
+		TradeType:     model.TradeTypeNative,
+		ProfitSharing: req.SettleInfo.ProfitSharing,
+	}, req.TimeExpire)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code_url": core.PublicBaseURL(c.Request) + "/pay/native/" + tx.PrepayID})
+}
+
+// NativeRedirect code_url 落地页，跳转到前端支付模拟页
+func NativeRedirect(c *gin.Context) {
+	prepayID := c.Param("prepay_id")
+
+	if _, err := service.FindByPrepayID(prepayID); err != nil {
+		c.String(http.StatusNotFound, "二维码已失效")
+		return
+	}
+
+	c.Redirect(http.StatusFound, core.WebBaseURL(c.Request)+"/pay/preview/"+prepayID)
+}
@@ -0,0 +1,203 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PartnerPrepayRequest 服务商模式下单请求参数 (JSAPI/APP/H5/Native 共用)
+type PartnerPrepayRequest struct {
+	SpAppID     string     `json:"sp_appid"`
+	SpMchid     string     `json:"sp_mchid"`
+	SubAppID    string     `json:"sub_appid"`
+	SubMchid    string     `json:"sub_mchid"`
+	Description string     `json:"description"`
+	OutTradeNo  string     `json:"out_trade_no"`
+	TimeExpire  string     `json:"time_expire"`
+	NotifyUrl   string     `json:"notify_url"`
+	SettleInfo  SettleInfo `json:"settle_info"`
+	Amount      struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+	Payer struct {
+		SpOpenID  string `json:"sp_openid"`
+		SubOpenID string `json:"sub_openid"`
+	} `json:"payer"`
+	SceneInfo json.RawMessage `json:"scene_info"`
+}
+
+// PartnerJSAPIPrepay 服务商 JSAPI 下单
+func PartnerJSAPIPrepay(c *gin.Context) {
+	tx, ok := createPartnerPrepay(c, model.TradeTypeJSAPI)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prepay_id": tx.PrepayID})
+}
+
+// PartnerAppPrepay 服务商 APP 下单
+func PartnerAppPrepay(c *gin.Context) {
+	tx, ok := createPartnerPrepay(c, model.TradeTypeApp)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prepay_id": tx.PrepayID})
+}
+
+// PartnerNativePrepay 服务商 Native 下单
+func PartnerNativePrepay(c *gin.Context) {
+	tx, ok := createPartnerPrepay(c, model.TradeTypeNative)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code_url": core.PublicBaseURL(c.Request) + "/pay/native/" + tx.PrepayID})
+}
+
+// PartnerH5Prepay 服务商 H5 下单
+func PartnerH5Prepay(c *gin.Context) {
+	tx, ok := createPartnerPrepay(c, model.TradeTypeMWeb)
+	if !ok {
+		return
+	}
+	h5Url := core.PublicBaseURL(c.Request) + "/pay/h5?prepay_id=" + tx.PrepayID + "&package=" + core.RandomString(10)
+	c.JSON(http.StatusOK, gin.H{"h5_url": h5Url})
+}
+
+// createPartnerPrepay 服务商下单公共逻辑：下单参数及服务商与特约商户的受理关系由 createPrepay 校验
+// 交易记录的 MchID/AppID 为特约商户号及其 appid，失败时已写入错误响应
+func createPartnerPrepay(c *gin.Context, tradeType string) (model.Transaction, bool) {
+	var req PartnerPrepayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return model.Transaction{}, false
+	}
+
+	// 服务商字段缺失时无法区分服务商模式，先行校验
+	var p paramChecker
+	p.str("/sp_appid", req.SpAppID, 1, 32)
+	p.str("/sp_mchid", req.SpMchid, 1, 32)
+	if !p.ok(c) {
+		return model.Transaction{}, false
+	}
+	if tradeType == model.TradeTypeMWeb && !checkH5SceneInfo(c, req.SceneInfo) {
+		return model.Transaction{}, false
+	}
+
+	return createPrepay(c, model.Transaction{
+		AppID:          req.SubAppID,
+		MchID:          req.SubMchid,
+		SpAppID:        req.SpAppID,
+		SpMchID:        req.SpMchid,
+		Description:    req.Description,
+		OutTradeNo:     req.OutTradeNo,
+		Amount:         req.Amount.Total,
+		Currency:       req.Amount.Currency,
+		PayerOpenID:    req.Payer.SpOpenID,
+		PayerSubOpenID: req.Payer.SubOpenID,
+		NotifyUrl:      req.NotifyUrl,
+		TradeType:      tradeType,
+		ProfitSharing:  req.SettleInfo.ProfitSharing,
+	}, req.TimeExpire)
+}
+
+// checkPartnerRelation 校验服务商商户号存在且特约商户隶属于该服务商，失败时已写入错误响应
+func checkPartnerRelation(c *gin.Context, spMchID, subMchID string) bool {
+	var sp model.Merchant
+	if result := core.DB.Where("mch_id = ?", spMchID).First(&sp); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return false
+	}
+
+	var sub model.Merchant
+	if result := core.DB.Where("mch_id = ?", subMchID).First(&sub); result.Error != nil || sub.ParentMchID != spMchID {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "特约商户与服务商不存在受理关系"})
+		return false
+	}
+	return true
+}
+
+// PartnerQueryByTransactionID 服务商模式微信支付订单号查询
+func PartnerQueryByTransactionID(c *gin.Context) {
+	queryPartnerTransaction(c, core.DB.Where("transaction_id = ?", c.Param("transaction_id")))
+}
+
+// PartnerQueryByOutTradeNo 服务商模式商户订单号查询
+func PartnerQueryByOutTradeNo(c *gin.Context) {
+	queryPartnerTransaction(c, core.DB.Where("out_trade_no = ?", c.Param("out_trade_no")))
+}
+
+// queryPartnerTransaction 按 sp_mchid/sub_mchid 查询服务商订单
+func queryPartnerTransaction(c *gin.Context, query *gorm.DB) {
+	spMchID := c.Query("sp_mchid")
+	subMchID := c.Query("sub_mchid")
+	if spMchID == "" || subMchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "sp_mchid and sub_mchid are required"})
+		return
+	}
+
+	var tx model.Transaction
+	if result := query.Where("sp_mch_id = ? AND mch_id = ?", spMchID, subMchID).First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "Transaction not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPartnerTransactionResponse(tx))
+}
+
+// PartnerCloseOrder 服务商模式关闭订单
+func PartnerCloseOrder(c *gin.Context) {
+	outTradeNo := c.Param("out_trade_no")
+
+	var req struct {
+		SpMchID  string `json:"sp_mchid"`
+		SubMchID string `json:"sub_mchid"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.SpMchID == "" || req.SubMchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "sp_mchid and sub_mchid are required"})
+		return
+	}
+
+	var tx model.Transaction
+	if result := core.DB.Where("out_trade_no = ? AND sp_mch_id = ? AND mch_id = ?", outTradeNo, req.SpMchID, req.SubMchID).First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "ORDER_NOT_EXIST", "message": "Order not found"})
+		return
+	}
+
+	closeOrder(c, tx)
+}
+
+// buildPartnerTransactionResponse 构建服务商模式订单响应结构 (sp_/sub_ 前缀字段)
+func buildPartnerTransactionResponse(tx model.Transaction) map[string]interface{} {
+	resp := buildTransactionResponse(tx)
+	delete(resp, "appid")
+	delete(resp, "mchid")
+	resp["sp_appid"] = tx.SpAppID
+	resp["sp_mchid"] = tx.SpMchID
+	resp["sub_appid"] = tx.AppID
+	resp["sub_mchid"] = tx.MchID
+	resp["payer"] = map[string]interface{}{
+		"sp_openid":  tx.PayerOpenID,
+		"sub_openid": tx.PayerSubOpenID,
+	}
+	return resp
+}
+
+// partnerScope 退款、分账等接口按请求方 (Authorization 或 Query) 限定查询范围：传入 sub_mchid 时为服务商模式，
+// 按特约商户号及服务商商户号过滤，否则按商户号过滤；无法确定请求方商户时已写入错误响应
+func partnerScope(c *gin.Context, query *gorm.DB, subMchID string) (*gorm.DB, bool) {
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return query, false
+	}
+	if subMchID != "" {
+		return query.Where("mch_id = ? AND sp_mch_id = ?", subMchID, mchid), true
+	}
+	return query.Where("mch_id = ?", mchid), true
+}
@@ -0,0 +1,172 @@
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SettleInfo 下单结算信息
+type SettleInfo struct {
+	ProfitSharing bool `json:"profit_sharing"` // 是否指定分账，指定后资金冻结待分账
+}
+
+// createPrepay 各下单接口公共逻辑：校验下单参数、商户及订单有效期，生成单号并保存交易记录
+// 未指定 Status 时以 NOTPAY 创建；商户订单号已存在且参数一致时返回原订单；失败时已写入错误响应，返回 false
+func createPrepay(c *gin.Context, tx model.Transaction, timeExpire string) (model.Transaction, bool) {
+	if !validatePrepay(c, tx) {
+		return tx, false
+	}
+	if tx.Currency == "" {
+		tx.Currency = "CNY"
+	}
+
+	// 服务商模式校验受理关系
+	if tx.SpMchID != "" && !checkPartnerRelation(c, tx.SpMchID, tx.MchID) {
+		return tx, false
+	}
+
+	// 校验商户是否存在
+	var mch model.Merchant
+	if result := core.DB.Where("mch_id = ?", tx.MchID).First(&mch); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return tx, false
+	}
+
+	// 校验 appid 与商户号的绑定关系 (服务商模式分别校验 sp_appid 与 sub_appid)
+	if tx.SpMchID != "" {
+		if !checkAppIDBinding(c, tx.SpAppID, tx.SpMchID) || (tx.AppID != "" && !checkAppIDBinding(c, tx.AppID, tx.MchID)) {
+			return tx, false
+		}
+	} else if !checkAppIDBinding(c, tx.AppID, tx.MchID) {
+		return tx, false
+	}
+
+	// 同一商户订单号重复下单：参数一致时返回原预支付交易
+	var existing model.Transaction
+	err := core.DB.Where("out_trade_no = ? AND mch_id = ?", tx.OutTradeNo, tx.MchID).First(&existing).Error
+	if err == nil {
+		return existing, reusePrepay(c, existing, tx, timeExpire)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+		return tx, false
+	}
+
+	expireAt, ok := parseTimeExpire(c, timeExpire)
+	if !ok {
+		return tx, false
+	}
+	tx.TimeExpire = &expireAt
+
+	// 生成 Mock PrepayID
+	tx.PrepayID = fmt.Sprintf("wx%s%06d", time.Now().Format("20060102150405"), rand.Intn(100000))
+	tx.TransactionID = fmt.Sprintf("420000%s%06d", time.Now().Format("20060102150405"), rand.Intn(100000))
+	if tx.Status == "" {
+		tx.Status = tradestate.NotPay
+	}
+
+	// 保存交易记录
+	if err := core.DB.Create(&tx).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": "SYSTEM_ERROR", "message": err.Error()})
+		return tx, false
+	}
+
+	return tx, true
+}
+
+// parseTimeExpire 解析下单参数 time_expire (RFC3339)，未传入时默认 2 小时后过期；失败时已写入错误响应
+func parseTimeExpire(c *gin.Context, timeExpire string) (time.Time, bool) {
+	if timeExpire == "" {
+		return time.Now().Add(model.DefaultTimeExpire), true
+	}
+
+	expireAt, err := time.Parse(time.RFC3339, timeExpire)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "time_expire格式不正确，应为yyyy-MM-DDTHH:mm:ss+TIMEZONE"})
+		return expireAt, false
+	}
+	if !expireAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "time_expire不能早于当前时间"})
+		return expireAt, false
+	}
+	return expireAt, true
+}
+
+// checkAppIDBinding 校验 appid 为商户自身的 AppID 或已绑定的 appid，失败时已写入错误响应
+func checkAppIDBinding(c *gin.Context, appid, mchid string) bool {
+	var count int64
+	core.DB.Model(&model.Merchant{}).Where("mch_id = ? AND app_id = ?", mchid, appid).Count(&count)
+	if count == 0 {
+		core.DB.Model(&model.MerchantAppID{}).Where("mch_id = ? AND app_id = ?", mchid, appid).Count(&count)
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "APPID_MCHID_NOT_MATCH", "message": "AppID和mch_id不匹配，请检查后再试"})
+		return false
+	}
+	return true
+}
+
+// reusePrepay 重复下单时校验原订单状态及下单参数，可返回原预支付交易时为 true；否则已写入错误响应
+func reusePrepay(c *gin.Context, existing, tx model.Transaction, timeExpire string) bool {
+	if existing.CombineID != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "商户订单号重复，该订单号已用于合单子单"})
+		return false
+	}
+
+	// 已过期但尚未被定时任务关闭的订单在此关闭
+	if service.CloseExpiredOrder(existing) != nil {
+		existing.Status = tradestate.Closed
+	}
+	if !checkOrderReusable(c, existing.Status) {
+		return false
+	}
+
+	if !samePrepayParams(existing, tx, timeExpire) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "商户订单号重复，且下单参数与原订单不一致"})
+		return false
+	}
+	return true
+}
+
+// checkOrderReusable 已支付或已关闭的订单不能重复下单；失败时已写入错误响应
+func checkOrderReusable(c *gin.Context, status string) bool {
+	switch status {
+	case tradestate.Success, tradestate.Refund:
+		c.JSON(http.StatusForbidden, gin.H{"code": "ORDERPAID", "message": "该订单已支付"})
+		return false
+	case tradestate.Closed, tradestate.Revoked:
+		c.JSON(http.StatusBadRequest, gin.H{"code": "ORDERCLOSED", "message": "当前订单已关闭，请重新下单"})
+		return false
+	}
+	return true
+}
+
+// samePrepayParams 重复下单的参数是否与原订单一致 (未传 time_expire 时不比较有效期)
+func samePrepayParams(existing, tx model.Transaction, timeExpire string) bool {
+	if existing.AppID != tx.AppID || existing.SpAppID != tx.SpAppID || existing.SpMchID != tx.SpMchID ||
+		existing.Description != tx.Description || existing.Amount != tx.Amount || existing.Currency != tx.Currency ||
+		existing.PayerOpenID != tx.PayerOpenID || existing.PayerSubOpenID != tx.PayerSubOpenID ||
+		existing.NotifyUrl != tx.NotifyUrl || existing.TradeType != tx.TradeType || existing.ProfitSharing != tx.ProfitSharing {
+		return false
+	}
+	return sameTimeExpire(existing.TimeExpire, timeExpire)
+}
+
+// sameTimeExpire 重复下单传入的 time_expire 是否与原订单一致
+func sameTimeExpire(existing *time.Time, timeExpire string) bool {
+	if timeExpire == "" {
+		return true
+	}
+	expireAt, err := time.Parse(time.RFC3339, timeExpire)
+	return err == nil && existing != nil && existing.Equal(expireAt)
+}
@@ -0,0 +1,189 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupTestDB 初始化测试数据库
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+}
+
+// postJSON 以 JSON 请求体调用 handler，返回状态码及应答
+func postJSON(t *testing.T, handler gin.HandlerFunc, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+// jsapiBody JSAPI 下单请求体，appid 为 "wx" + mchid
+func jsapiBody(mchid, outTradeNo string, total int64) map[string]interface{} {
+	return map[string]interface{}{
+		"appid":        "wx" + mchid,
+		"mchid":        mchid,
+		"description":  "测试商品",
+		"out_trade_no": outTradeNo,
+		"notify_url":   "https://example.com/notify",
+		"amount":       map[string]interface{}{"total": total, "currency": "CNY"},
+		"payer":        map[string]interface{}{"openid": "openid"},
+	}
+}
+
+func TestPrepayIdempotent(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+	core.DB.Create(&model.Merchant{AppID: "wx200", MchID: "200"})
+
+	status, resp := postJSON(t, JSAPIPrepay, jsapiBody("100", "ORDER_000001", 100))
+	prepayID, _ := resp["prepay_id"].(string)
+	if status != http.StatusOK || prepayID == "" {
+		t.Fatalf("first prepay = %d %v", status, resp)
+	}
+
+	changed := jsapiBody("100", "ORDER_000001", 100)
+	changed["description"] = "其他商品"
+	tests := []struct {
+		name       string
+		body       map[string]interface{}
+		wantStatus int
+		wantCode   string // 为空表示返回原 prepay_id
+	}{
+		{"same params", jsapiBody("100", "ORDER_000001", 100), http.StatusOK, ""},
+		{"different amount", jsapiBody("100", "ORDER_000001", 200), http.StatusBadRequest, "INVALID_REQUEST"},
+		{"different description", changed, http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+	for _, tt := range tests {
+		status, resp := postJSON(t, JSAPIPrepay, tt.body)
+		if status != tt.wantStatus || (tt.wantCode != "" && resp["code"] != tt.wantCode) {
+			t.Errorf("%s: response = %d %v, want %d %s", tt.name, status, resp, tt.wantStatus, tt.wantCode)
+			continue
+		}
+		if tt.wantCode == "" && resp["prepay_id"] != prepayID {
+			t.Errorf("%s: prepay_id = %v, want %s", tt.name, resp["prepay_id"], prepayID)
+		}
+	}
+
+	// 商户订单号在商户内唯一，其他商户可使用相同单号
+	status, resp = postJSON(t, JSAPIPrepay, jsapiBody("200", "ORDER_000001", 100))
+	if status != http.StatusOK || resp["prepay_id"] == "" || resp["prepay_id"] == prepayID {
+		t.Errorf("another merchant: response = %d %v", status, resp)
+	}
+
+	var count int64
+	core.DB.Model(&model.Transaction{}).Where("out_trade_no = ?", "ORDER_000001").Count(&count)
+	if count != 2 {
+		t.Errorf("order count = %d, want 2", count)
+	}
+}
+
+func TestPrepayFinishedOrder(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name       string
+		status     string
+		timeExpire *time.Time
+		wantStatus int
+		wantCode   string
+	}{
+		{"paid", tradestate.Success, nil, http.StatusForbidden, "ORDERPAID"},
+		{"refunded", tradestate.Refund, nil, http.StatusForbidden, "ORDERPAID"},
+		{"closed", tradestate.Closed, nil, http.StatusBadRequest, "ORDERCLOSED"},
+		{"revoked", tradestate.Revoked, nil, http.StatusBadRequest, "ORDERCLOSED"},
+		{"expired", tradestate.NotPay, &past, http.StatusBadRequest, "ORDERCLOSED"},
+	}
+	for i, tt := range tests {
+		outTradeNo := fmt.Sprintf("ORDER_%06d", i+1)
+		core.DB.Create(&model.Transaction{
+			AppID:         "wx100",
+			MchID:         "100",
+			Description:   "测试商品",
+			OutTradeNo:    outTradeNo,
+			TransactionID: fmt.Sprintf("42000000%02d", i+1),
+			Amount:        100,
+			Currency:      "CNY",
+			PayerOpenID:   "openid",
+			NotifyUrl:     "https://example.com/notify",
+			TradeType:     model.TradeTypeJSAPI,
+			Status:        tt.status,
+			TimeExpire:    tt.timeExpire,
+		})
+
+		status, resp := postJSON(t, JSAPIPrepay, jsapiBody("100", outTradeNo, 100))
+		if status != tt.wantStatus || resp["code"] != tt.wantCode {
+			t.Errorf("%s: response = %d %v, want %d %s", tt.name, status, resp, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestCheckAppIDBinding(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+	core.DB.Create(&model.Merchant{AppID: "wx200", MchID: "200"})
+	core.DB.Create(&model.MerchantAppID{MchID: "100", AppID: "wx_mini"})
+	core.DB.Create(&model.MerchantAppID{MchID: "200", AppID: "wx_mini"})
+
+	tests := []struct {
+		name, appid, mchid string
+		want               bool
+	}{
+		{"own appid", "wx100", "100", true},
+		{"bound appid", "wx_mini", "100", true},
+		{"appid bound to several merchants", "wx_mini", "200", true},
+		{"another merchant's appid", "wx200", "100", false},
+		{"unknown appid", "wx_unknown", "100", false},
+		{"unknown merchant", "wx100", "300", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		if got := checkAppIDBinding(c, tt.appid, tt.mchid); got != tt.want {
+			t.Errorf("%s: checkAppIDBinding(%s, %s) = %v, want %v", tt.name, tt.appid, tt.mchid, got, tt.want)
+			continue
+		}
+		if !tt.want && (w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "APPID_MCHID_NOT_MATCH")) {
+			t.Errorf("%s: response = %d %s, want 400 APPID_MCHID_NOT_MATCH", tt.name, w.Code, w.Body.String())
+		}
+	}
+
+	// 下单时校验 appid 与商户号的绑定关系
+	body := jsapiBody("100", "ORDER_000001", 100)
+	body["appid"] = "wx200"
+	if status, resp := postJSON(t, JSAPIPrepay, body); status != http.StatusBadRequest || resp["code"] != "APPID_MCHID_NOT_MATCH" {
+		t.Errorf("prepay with unbound appid = %d %v", status, resp)
+	}
+	body["appid"] = "wx_mini"
+	if status, resp := postJSON(t, JSAPIPrepay, body); status != http.StatusOK {
+		t.Errorf("prepay with bound appid = %d %v", status, resp)
+	}
+}
@@ -0,0 +1,385 @@
+package mock
+
+import (
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProfitSharingReceiverRequest 添加/删除分账接收方请求参数
+type ProfitSharingReceiverRequest struct {
+	SubMchid       string `json:"sub_mchid"` // 服务商模式：特约商户号
+	AppID          string `json:"appid"`
+	SubAppID       string `json:"sub_appid"`
+	Type           string `json:"type"`
+	Account        string `json:"account"`
+	Name           string `json:"name"`
+	RelationType   string `json:"relation_type"`
+	CustomRelation string `json:"custom_relation"`
+}
+
+// AddProfitSharingReceiver 添加分账接收方
+func AddProfitSharingReceiver(c *gin.Context) {
+	var req ProfitSharingReceiverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	mchid, spMchID, ok := profitSharingMerchant(c, req.SubMchid)
+	if !ok {
+		return
+	}
+
+	receiver, err := service.AddProfitSharingReceiver(model.ProfitSharingReceiver{
+		MchID:          mchid,
+		SpMchID:        spMchID,
+		AppID:          req.AppID,
+		Type:           req.Type,
+		Account:        req.Account,
+		Name:           req.Name,
+		RelationType:   req.RelationType,
+		CustomRelation: req.CustomRelation,
+	})
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	resp := gin.H{
+		"type":            receiver.Type,
+		"account":         receiver.Account,
+		"relation_type":   receiver.RelationType,
+		"custom_relation": receiver.CustomRelation,
+	}
+	if spMchID != "" {
+		resp["sub_mchid"] = mchid
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteProfitSharingReceiver 删除分账接收方
+func DeleteProfitSharingReceiver(c *gin.Context) {
+	var req ProfitSharingReceiverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	mchid, spMchID, ok := profitSharingMerchant(c, req.SubMchid)
+	if !ok {
+		return
+	}
+
+	if err := service.DeleteProfitSharingReceiver(mchid, req.Type, req.Account); err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	resp := gin.H{"type": req.Type, "account": req.Account}
+	if spMchID != "" {
+		resp["sub_mchid"] = mchid
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// profitSharingMerchant 确定分账接收方所属商户：请求方商户号取自 Authorization/Query；
+// 服务商模式 (传入 sub_mchid) 返回特约商户号及服务商商户号，失败时已写入错误响应
+func profitSharingMerchant(c *gin.Context, subMchID string) (string, string, bool) {
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return "", "", false
+	}
+
+	if subMchID != "" {
+		if !checkPartnerRelation(c, mchid, subMchID) {
+			return "", "", false
+		}
+		return subMchID, mchid, true
+	}
+
+	var mch model.Merchant
+	if result := core.DB.Where("mch_id = ?", mchid).First(&mch); result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return "", "", false
+	}
+	return mchid, "", true
+}
+
+// ProfitSharingOrderRequest 请求分账参数
+type ProfitSharingOrderRequest struct {
+	SubMchid      string `json:"sub_mchid"`
+	AppID         string `json:"appid"`
+	TransactionID string `json:"transaction_id"`
+	OutOrderNo    string `json:"out_order_no"`
+	Receivers     []struct {
+		Type        string `json:"type"`
+		Account     string `json:"account"`
+		Name        string `json:"name"`
+		Amount      int64  `json:"amount"`
+		Description string `json:"description"`
+	} `json:"receivers"`
+	UnfreezeUnsplit bool `json:"unfreeze_unsplit"`
+}
+
+// CreateProfitSharingOrder 请求分账
+func CreateProfitSharingOrder(c *gin.Context) {
+	var req ProfitSharingOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	tx, ok := profitSharingTransaction(c, req.TransactionID, req.SubMchid)
+	if !ok {
+		return
+	}
+
+	receivers := make([]service.ProfitSharingReceiverParams, 0, len(req.Receivers))
+	for _, r := range req.Receivers {
+		receivers = append(receivers, service.ProfitSharingReceiverParams{
+			Type:        r.Type,
+			Account:     r.Account,
+			Amount:      r.Amount,
+			Description: r.Description,
+		})
+	}
+
+	order, err := service.CreateProfitSharing(tx, req.OutOrderNo, receivers, req.UnfreezeUnsplit)
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildProfitSharingOrderResponse(order))
+}
+
+// UnfreezeProfitSharingOrder 解冻剩余资金
+func UnfreezeProfitSharingOrder(c *gin.Context) {
+	var req struct {
+		SubMchid      string `json:"sub_mchid"`
+		TransactionID string `json:"transaction_id"`
+		OutOrderNo    string `json:"out_order_no"`
+		Description   string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	tx, ok := profitSharingTransaction(c, req.TransactionID, req.SubMchid)
+	if !ok {
+		return
+	}
+
+	order, err := service.UnfreezeProfitSharing(tx, req.OutOrderNo, req.Description)
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildProfitSharingOrderResponse(order))
+}
+
+// QueryProfitSharingOrder 查询分账结果
+func QueryProfitSharingOrder(c *gin.Context) {
+	transactionID := c.Query("transaction_id")
+	if transactionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "transaction_id is required"})
+		return
+	}
+
+	query := core.DB.Preload("Receivers").Where("out_order_no = ? AND transaction_id = ?", c.Param("out_order_no"), transactionID)
+	query, ok := partnerScope(c, query, c.Query("sub_mchid"))
+	if !ok {
+		return
+	}
+	var order model.ProfitSharingOrder
+	if result := query.First(&order); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "分账单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildProfitSharingOrderResponse(order))
+}
+
+// QueryUnsplitAmount 查询订单剩余待分金额
+func QueryUnsplitAmount(c *gin.Context) {
+	// 服务商可查询其特约商户的订单
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return
+	}
+	var tx model.Transaction
+	if result := core.DB.Where("transaction_id = ? AND (mch_id = ? OR sp_mch_id = ?)", c.Param("transaction_id"), mchid, mchid).First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transaction_id": tx.TransactionID,
+		"unsplit_amount": service.UnsplitAmount(tx),
+	})
+}
+
+// profitSharingTransaction 查找分账对应的支付订单，失败时已写入错误响应
+func profitSharingTransaction(c *gin.Context, transactionID, subMchID string) (model.Transaction, bool) {
+	var tx model.Transaction
+	if transactionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "transaction_id is required"})
+		return tx, false
+	}
+
+	query, ok := partnerScope(c, core.DB.Where("transaction_id = ?", transactionID), subMchID)
+	if !ok {
+		return tx, false
+	}
+	if result := query.First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "订单不存在"})
+		return tx, false
+	}
+	return tx, true
+}
+
+// ProfitSharingReturnRequest 请求分账回退参数
+type ProfitSharingReturnRequest struct {
+	SubMchid    string `json:"sub_mchid"`
+	OrderID     string `json:"order_id"`
+	OutOrderNo  string `json:"out_order_no"`
+	OutReturnNo string `json:"out_return_no"`
+	ReturnMchid string `json:"return_mchid"`
+	Amount      int64  `json:"amount"`
+	Description string `json:"description"`
+}
+
+// CreateProfitSharingReturn 请求分账回退
+func CreateProfitSharingReturn(c *gin.Context) {
+	var req ProfitSharingReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	if req.OrderID == "" && req.OutOrderNo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "order_id和out_order_no必须二选一进行传参"})
+		return
+	}
+
+	query := core.DB.Preload("Receivers")
+	if req.OrderID != "" {
+		query = query.Where("order_id = ?", req.OrderID)
+	} else {
+		query = query.Where("out_order_no = ?", req.OutOrderNo)
+	}
+	query, ok := partnerScope(c, query, req.SubMchid)
+	if !ok {
+		return
+	}
+	var order model.ProfitSharingOrder
+	if result := query.First(&order); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "分账单不存在"})
+		return
+	}
+
+	ret, err := service.CreateProfitSharingReturn(order, service.ProfitSharingReturnParams{
+		OutReturnNo: req.OutReturnNo,
+		ReturnMchID: req.ReturnMchid,
+		Amount:      req.Amount,
+		Description: req.Description,
+	})
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildProfitSharingReturnResponse(ret))
+}
+
+// QueryProfitSharingReturn 查询分账回退结果
+func QueryProfitSharingReturn(c *gin.Context) {
+	outOrderNo := c.Query("out_order_no")
+	if outOrderNo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "out_order_no is required"})
+		return
+	}
+
+	query := core.DB.Where("out_return_no = ? AND out_order_no = ?", c.Param("out_return_no"), outOrderNo)
+	query, ok := partnerScope(c, query, c.Query("sub_mchid"))
+	if !ok {
+		return
+	}
+	var ret model.ProfitSharingReturn
+	if result := query.First(&ret); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "回退单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildProfitSharingReturnResponse(ret))
+}
+
+// buildProfitSharingOrderResponse 构建分账单响应结构
+func buildProfitSharingOrderResponse(order model.ProfitSharingOrder) map[string]interface{} {
+	receivers := make([]map[string]interface{}, 0, len(order.Receivers))
+	for _, d := range order.Receivers {
+		item := map[string]interface{}{
+			"amount":      d.Amount,
+			"description": d.Description,
+			"type":        d.Type,
+			"account":     d.Account,
+			"result":      d.Result,
+			"fail_reason": d.FailReason,
+			"detail_id":   d.DetailID,
+			"create_time": d.CreatedAt.Format(time.RFC3339),
+		}
+		if d.FinishedAt != nil {
+			item["finish_time"] = d.FinishedAt.Format(time.RFC3339)
+		}
+		receivers = append(receivers, item)
+	}
+
+	resp := map[string]interface{}{
+		"transaction_id": order.TransactionID,
+		"out_order_no":   order.OutOrderNo,
+		"order_id":       order.OrderID,
+		"state":          order.State,
+		"receivers":      receivers,
+	}
+	if order.SpMchID != "" {
+		resp["sub_mchid"] = order.MchID
+	}
+	return resp
+}
+
+// buildProfitSharingReturnResponse 构建分账回退单响应结构
+func buildProfitSharingReturnResponse(ret model.ProfitSharingReturn) map[string]interface{} {
+	resp := map[string]interface{}{
+		"order_id":      ret.OrderID,
+		"out_order_no":  ret.OutOrderNo,
+		"out_return_no": ret.OutReturnNo,
+		"return_id":     ret.ReturnID,
+		"return_mchid":  ret.ReturnMchID,
+		"amount":        ret.Amount,
+		"description":   ret.Description,
+		"result":        ret.Result,
+		"fail_reason":   ret.FailReason,
+		"create_time":   ret.CreatedAt.Format(time.RFC3339),
+	}
+	if ret.FinishedAt != nil {
+		resp["finish_time"] = ret.FinishedAt.Format(time.RFC3339)
+	}
+	if ret.SpMchID != "" {
+		resp["sub_mchid"] = ret.MchID
+	}
+	return resp
+}
@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAddProfitSharingReceiverMerchant(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+	core.DB.Create(&model.Merchant{AppID: "wx200", MchID: "200"})
+
+	// 请求体中的 appid 不用于确定商户
+	body := []byte(`{"appid": "wx100", "type": "PERSONAL_OPENID", "account": "openid_1", "relation_type": "USER"}`)
+	tests := []struct {
+		name       string
+		query      string
+		auth       string
+		wantStatus int
+		wantMchID  string
+	}{
+		{"appid only", "", "", http.StatusBadRequest, ""},
+		{"mchid in query", "?mchid=100", "", http.StatusOK, "100"},
+		{"mchid in authorization", "", `WECHATPAY2-SHA256-RSA2048 mchid="200"`, http.StatusOK, "200"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v3/profitsharing/receivers/add"+tt.query, bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if tt.auth != "" {
+			c.Request.Header.Set("Authorization", tt.auth)
+		}
+		AddProfitSharingReceiver(c)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: response = %d %s, want %d", tt.name, w.Code, w.Body.String(), tt.wantStatus)
+			continue
+		}
+		if tt.wantMchID == "" {
+			continue
+		}
+		var count int64
+		core.DB.Model(&model.ProfitSharingReceiver{}).Where("mch_id = ? AND account = ?", tt.wantMchID, "openid_1").Count(&count)
+		if count != 1 {
+			t.Errorf("%s: receivers of %s = %d, want 1", tt.name, tt.wantMchID, count)
+		}
+	}
+}
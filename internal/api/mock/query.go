@@ -5,6 +5,8 @@ import (
 	"time"
 	"wepay-sandbox/internal/core"
 	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+	"wepay-sandbox/internal/tradestate"
 
 	"github.com/gin-gonic/gin"
 )
@@ -66,13 +68,13 @@ func buildTransactionResponse(tx model.Transaction) map[string]interface{} {
 		"mchid":            tx.MchID,
 		"out_trade_no":     tx.OutTradeNo,
 		"transaction_id":   tx.TransactionID,
-		"trade_type":       "JSAPI",
+		"trade_type":       tx.TradeType,
 		"trade_state":      tx.Status,
-		"trade_state_desc": "支付成功", // 简化描述
+		"trade_state_desc": tradestate.Desc(tx.Status),
 		"bank_type":        "OTHERS",
-		"attach":           "",
+		"attach":           tx.Attach,
 		"payer": map[string]interface{}{
-			"openid": "mock_openid_123", // 模拟 OpenID
+			"openid": tx.PayerOpenID,
 		},
 		"amount": map[string]interface{}{
 			"total":          tx.Amount,
@@ -82,8 +84,17 @@ func buildTransactionResponse(tx model.Transaction) map[string]interface{} {
 		},
 	}
 
-	if tx.Status == "SUCCESS" {
-		resp["success_time"] = tx.UpdatedAt.Format(time.RFC3339)
+	// 沙箱扩展字段：累计退款及剩余可退金额
+	if tx.Status == tradestate.Success || tx.Status == tradestate.Refund {
+		refunded := service.RefundedAmount(tx.TransactionID)
+		amount := resp["amount"].(map[string]interface{})
+		amount["refunded_total"] = refunded
+		amount["refundable_total"] = tx.Amount - refunded
+	}
+
+	// 支付完成时间：已支付 (含转入退款) 的订单均返回，与支付通知一致
+	if (tx.Status == tradestate.Success || tx.Status == tradestate.Refund) && tx.PaidAt != nil {
+		resp["success_time"] = tx.PaidAt.Format(time.RFC3339)
 	}
 
 	return resp
@@ -0,0 +1,53 @@
+package mock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+)
+
+func TestBuildTransactionResponse(t *testing.T) {
+	setupTestDB(t)
+	paidAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+	tests := []struct {
+		name            string
+		status          string
+		paidAt          *time.Time
+		wantSuccessTime string // 为空表示不返回 success_time
+	}{
+		{"success", tradestate.Success, &paidAt, "2024-03-01T10:00:00+08:00"},
+		{"refund", tradestate.Refund, &paidAt, "2024-03-01T10:00:00+08:00"},
+		{"paid without paid_at", tradestate.Success, nil, ""},
+		{"not paid", tradestate.NotPay, nil, ""},
+		{"closed", tradestate.Closed, nil, ""},
+	}
+	for i, tt := range tests {
+		tx := model.Transaction{
+			MchID:         "100",
+			TransactionID: fmt.Sprintf("42000000%02d", i+1),
+			PayerOpenID:   "oUpF8uMuAJO_M2pxb1Q9zNjWeS6o",
+			Status:        tt.status,
+			PaidAt:        tt.paidAt,
+		}
+		core.DB.Create(&tx)
+		resp := buildTransactionResponse(tx)
+
+		if payer := resp["payer"].(map[string]interface{}); payer["openid"] != tx.PayerOpenID {
+			t.Errorf("%s: payer.openid = %v, want %s", tt.name, payer["openid"], tx.PayerOpenID)
+		}
+		successTime, ok := resp["success_time"]
+		if tt.wantSuccessTime == "" {
+			if ok {
+				t.Errorf("%s: success_time = %v, want omitted", tt.name, successTime)
+			}
+			continue
+		}
+		if successTime != tt.wantSuccessTime {
+			t.Errorf("%s: success_time = %v, want %s", tt.name, successTime, tt.wantSuccessTime)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package mock
+
+import (
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefundRequest 退款申请请求参数
+type RefundRequest struct {
+	SubMchid      string `json:"sub_mchid"` // 服务商模式：特约商户号
+	TransactionID string `json:"transaction_id"`
+	OutTradeNo    string `json:"out_trade_no"`
+	OutRefundNo   string `json:"out_refund_no"`
+	Reason        string `json:"reason"`
+	NotifyUrl     string `json:"notify_url"`
+	FundsAccount  string `json:"funds_account"`
+	Amount        struct {
+		Refund   int64  `json:"refund"`
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// CreateRefund 申请退款
+func CreateRefund(c *gin.Context) {
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	if req.TransactionID == "" && req.OutTradeNo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "transaction_id和out_trade_no必须二选一进行传参"})
+		return
+	}
+	if req.OutRefundNo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "out_refund_no is required"})
+		return
+	}
+	if req.Amount.Currency != "" && req.Amount.Currency != "CNY" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "currency only supports CNY"})
+		return
+	}
+
+	// 查找原订单 (优先微信支付订单号)，商户号取自 Authorization 头，服务商模式按 sub_mchid 查找
+	query, ok := partnerScope(c, core.DB, req.SubMchid)
+	if !ok {
+		return
+	}
+	if req.TransactionID != "" {
+		query = query.Where("transaction_id = ?", req.TransactionID)
+	} else {
+		query = query.Where("out_trade_no = ?", req.OutTradeNo)
+	}
+
+	var tx model.Transaction
+	if result := query.First(&tx); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "订单不存在"})
+		return
+	}
+
+	if req.Amount.Total != tx.Amount {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "订单金额与原订单不一致"})
+		return
+	}
+
+	refund, err := service.CreateRefund(tx, service.RefundParams{
+		OutRefundNo:  req.OutRefundNo,
+		Amount:       req.Amount.Refund,
+		Reason:       req.Reason,
+		NotifyUrl:    req.NotifyUrl,
+		FundsAccount: req.FundsAccount,
+	})
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildRefundResponse(refund, tx))
+}
+
+// QueryRefund 查询单笔退款 (通过商户退款单号)
+func QueryRefund(c *gin.Context) {
+	outRefundNo := c.Param("out_refund_no")
+
+	query, ok := partnerScope(c, core.DB.Where("out_refund_no = ?", outRefundNo), c.Query("sub_mchid"))
+	if !ok {
+		return
+	}
+
+	var refund model.Refund
+	if result := query.First(&refund); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    "RESOURCE_NOT_EXISTS",
+			"message": "退款单不存在",
+		})
+		return
+	}
+
+	var tx model.Transaction
+	core.DB.Where("transaction_id = ?", refund.TransactionID).First(&tx)
+
+	c.JSON(http.StatusOK, buildRefundResponse(refund, tx))
+}
+
+// AbnormalRefundRequest 发起异常退款请求参数
+type AbnormalRefundRequest struct {
+	SubMchid    string `json:"sub_mchid"` // 服务商模式：特约商户号
+	OutRefundNo string `json:"out_refund_no"`
+	Type        string `json:"type"`
+	BankType    string `json:"bank_type"`
+	BankAccount string `json:"bank_account"`
+	RealName    string `json:"real_name"`
+}
+
+// ApplyAbnormalRefund 发起异常退款
+func ApplyAbnormalRefund(c *gin.Context) {
+	refundID := c.Param("refund_id")
+
+	var req AbnormalRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	// 校验退款单归属
+	query, ok := partnerScope(c, core.DB.Where("refund_id = ?", refundID), req.SubMchid)
+	if !ok {
+		return
+	}
+	var existing model.Refund
+	if result := query.First(&existing); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_EXISTS", "message": "退款单不存在"})
+		return
+	}
+
+	refund, err := service.ApplyAbnormalRefund(refundID, service.AbnormalRefundParams{
+		OutRefundNo: req.OutRefundNo,
+		Type:        req.Type,
+		BankType:    req.BankType,
+		BankAccount: req.BankAccount,
+		RealName:    req.RealName,
+	})
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	var tx model.Transaction
+	core.DB.Where("transaction_id = ?", refund.TransactionID).First(&tx)
+
+	c.JSON(http.StatusOK, buildRefundResponse(refund, tx))
+}
+
+// buildRefundResponse 构建退款单标准响应结构
+func buildRefundResponse(refund model.Refund, tx model.Transaction) map[string]interface{} {
+	resp := map[string]interface{}{
+		"refund_id":             refund.RefundID,
+		"out_refund_no":         refund.OutRefundNo,
+		"transaction_id":        refund.TransactionID,
+		"out_trade_no":          tx.OutTradeNo,
+		"channel":               refund.Channel,
+		"user_received_account": refund.UserReceivedAccount,
+		"create_time":           refund.CreatedAt.Format(time.RFC3339),
+		"status":                refund.Status,
+		"funds_account":         refund.FundsAccount,
+		"amount": map[string]interface{}{
+			"total":             refund.Total,
+			"refund":            refund.Amount,
+			"payer_total":       refund.Total,
+			"payer_refund":      refund.Amount,
+			"settlement_total":  refund.Total,
+			"settlement_refund": refund.Amount,
+			"discount_refund":   0,
+			"currency":          refund.Currency,
+			"refund_fee":        0,
+			"from":              []interface{}{},
+		},
+		"promotion_detail": []interface{}{},
+	}
+
+	if refund.SuccessAt != nil {
+		resp["success_time"] = refund.SuccessAt.Format(time.RFC3339)
+	}
+
+	return resp
+}
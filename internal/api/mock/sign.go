@@ -0,0 +1,63 @@
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedWriter 缓存应答内容，待签名完成后再统一写出
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow 延迟到签名完成后再写出响应头
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+// SignResponse 应答签名中间件
+// 使用商户对应的沙箱平台证书对应答主体签名，并设置 Wechatpay-* 应答头，以通过官方 SDK 的应答验签
+func SignResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mchid := resolveMchID(c, readBody(c))
+
+		var mch model.Merchant
+		if mchid == "" || core.DB.Where("mch_id = ?", mchid).First(&mch).Error != nil {
+			c.Next()
+			return
+		}
+
+		origin := c.Writer
+		writer := &bufferedWriter{ResponseWriter: origin, body: &bytes.Buffer{}}
+		c.Writer = writer
+		c.Next()
+		c.Writer = origin
+
+		body := writer.body.Bytes()
+		headers, err := core.SignatureHeaders(mch.MchID, body)
+		if err != nil {
+			fmt.Printf("Sign response for merchant %s failed: %v\n", mch.MchID, err)
+		}
+		for k, v := range headers {
+			origin.Header().Set(k, v)
+		}
+		origin.Header().Set("Request-ID", core.RandomString(32))
+
+		if len(body) > 0 {
+			origin.Write(body)
+		} else {
+			origin.WriteHeaderNow()
+		}
+	}
+}
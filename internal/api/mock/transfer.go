@@ -0,0 +1,223 @@
+package mock
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TransferBatchRequest 发起商家转账请求参数
+type TransferBatchRequest struct {
+	AppID              string `json:"appid"`
+	OutBatchNo         string `json:"out_batch_no"`
+	BatchName          string `json:"batch_name"`
+	BatchRemark        string `json:"batch_remark"`
+	TotalAmount        int64  `json:"total_amount"`
+	TotalNum           int    `json:"total_num"`
+	TransferSceneID    string `json:"transfer_scene_id"`
+	NotifyUrl          string `json:"notify_url"`
+	TransferDetailList []struct {
+		OutDetailNo    string `json:"out_detail_no"`
+		TransferAmount int64  `json:"transfer_amount"`
+		TransferRemark string `json:"transfer_remark"`
+		OpenID         string `json:"openid"`
+		UserName       string `json:"user_name"`
+	} `json:"transfer_detail_list"`
+}
+
+// CreateTransferBatch 发起商家转账
+func CreateTransferBatch(c *gin.Context) {
+	var req TransferBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": err.Error()})
+		return
+	}
+
+	// 请求方商户号取自 Authorization/Query，不按 appid 推断 (appid 可能绑定多个商户)
+	mchid := requestMchID(c)
+	if mchid == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "MCH_NOT_FOUND", "message": "Merchant not configured in sandbox"})
+		return
+	}
+
+	details := make([]service.TransferDetailParams, 0, len(req.TransferDetailList))
+	for _, d := range req.TransferDetailList {
+		details = append(details, service.TransferDetailParams{
+			OutDetailNo:    d.OutDetailNo,
+			TransferAmount: d.TransferAmount,
+			TransferRemark: d.TransferRemark,
+			OpenID:         d.OpenID,
+			UserName:       d.UserName,
+		})
+	}
+
+	batch, err := service.CreateTransferBatch(mchid, service.TransferBatchParams{
+		AppID:           req.AppID,
+		OutBatchNo:      req.OutBatchNo,
+		BatchName:       req.BatchName,
+		BatchRemark:     req.BatchRemark,
+		TotalAmount:     req.TotalAmount,
+		TotalNum:        req.TotalNum,
+		TransferSceneID: req.TransferSceneID,
+		NotifyUrl:       req.NotifyUrl,
+		Details:         details,
+	})
+	if err != nil {
+		status, code, message := service.ErrorDetail(err)
+		c.JSON(status, gin.H{"code": code, "message": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"out_batch_no": batch.OutBatchNo,
+		"batch_id":     batch.BatchID,
+		"create_time":  batch.CreatedAt.Format(time.RFC3339),
+		"batch_status": batch.BatchStatus,
+	})
+}
+
+// QueryTransferBatchByID 微信批次单号查询批次单
+func QueryTransferBatchByID(c *gin.Context) {
+	queryTransferBatch(c, core.DB.Where("batch_id = ?", c.Param("batch_id")))
+}
+
+// QueryTransferBatchByOutNo 商家批次单号查询批次单
+func QueryTransferBatchByOutNo(c *gin.Context) {
+	queryTransferBatch(c, core.DB.Where("out_batch_no = ?", c.Param("out_batch_no")))
+}
+
+// queryTransferBatch 查询批次单，need_query_detail=true 时按 offset/limit/detail_status 分页返回明细
+func queryTransferBatch(c *gin.Context, query *gorm.DB) {
+	query, ok := partnerScope(c, query, "")
+	if !ok {
+		return
+	}
+	var batch model.TransferBatch
+	if result := query.First(&batch); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "NOT_FOUND", "message": "记录不存在"})
+		return
+	}
+
+	resp := gin.H{"transfer_batch": buildTransferBatchResponse(batch)}
+	if c.Query("need_query_detail") != "true" {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "offset不合法"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "limit取值范围为1~100"})
+		return
+	}
+
+	detailQuery := core.DB.Where("transfer_batch_id = ?", batch.ID).Order("id")
+	switch status := c.DefaultQuery("detail_status", "ALL"); status {
+	case "ALL":
+	case "SUCCESS", "FAIL":
+		detailQuery = detailQuery.Where("detail_status = ?", status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": "PARAM_ERROR", "message": "detail_status只能为ALL、SUCCESS或FAIL"})
+		return
+	}
+
+	var details []model.TransferDetail
+	detailQuery.Offset(offset).Limit(limit).Find(&details)
+
+	list := make([]gin.H, 0, len(details))
+	for _, d := range details {
+		list = append(list, gin.H{
+			"detail_id":     d.DetailID,
+			"out_detail_no": d.OutDetailNo,
+			"detail_status": d.DetailStatus,
+		})
+	}
+	resp["transfer_detail_list"] = list
+	resp["offset"] = offset
+	resp["limit"] = limit
+	c.JSON(http.StatusOK, resp)
+}
+
+// QueryTransferDetailByID 微信明细单号查询明细单
+func QueryTransferDetailByID(c *gin.Context) {
+	queryTransferDetail(c, core.DB.Where("batch_id = ?", c.Param("batch_id")),
+		core.DB.Where("detail_id = ?", c.Param("detail_id")))
+}
+
+// QueryTransferDetailByOutNo 商家明细单号查询明细单
+func QueryTransferDetailByOutNo(c *gin.Context) {
+	queryTransferDetail(c, core.DB.Where("out_batch_no = ?", c.Param("out_batch_no")),
+		core.DB.Where("out_detail_no = ?", c.Param("out_detail_no")))
+}
+
+// queryTransferDetail 查询批次内的明细单
+func queryTransferDetail(c *gin.Context, batchQuery, detailQuery *gorm.DB) {
+	batchQuery, ok := partnerScope(c, batchQuery, "")
+	if !ok {
+		return
+	}
+	var batch model.TransferBatch
+	if result := batchQuery.First(&batch); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "NOT_FOUND", "message": "记录不存在"})
+		return
+	}
+
+	var detail model.TransferDetail
+	if result := detailQuery.Where("transfer_batch_id = ?", batch.ID).First(&detail); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": "NOT_FOUND", "message": "记录不存在"})
+		return
+	}
+
+	resp := gin.H{
+		"mchid":           batch.MchID,
+		"out_batch_no":    batch.OutBatchNo,
+		"batch_id":        batch.BatchID,
+		"appid":           batch.AppID,
+		"out_detail_no":   detail.OutDetailNo,
+		"detail_id":       detail.DetailID,
+		"detail_status":   detail.DetailStatus,
+		"transfer_amount": detail.TransferAmount,
+		"transfer_remark": detail.TransferRemark,
+		"openid":          detail.OpenID,
+		"user_name":       detail.UserName,
+		"initiate_time":   detail.CreatedAt.Format(time.RFC3339),
+		"update_time":     detail.UpdatedAt.Format(time.RFC3339),
+	}
+	if detail.FailReason != "" {
+		resp["fail_reason"] = detail.FailReason
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// buildTransferBatchResponse 构建批次单响应结构
+func buildTransferBatchResponse(batch model.TransferBatch) map[string]interface{} {
+	return map[string]interface{}{
+		"mchid":             batch.MchID,
+		"out_batch_no":      batch.OutBatchNo,
+		"batch_id":          batch.BatchID,
+		"appid":             batch.AppID,
+		"batch_status":      batch.BatchStatus,
+		"batch_type":        "API",
+		"batch_name":        batch.BatchName,
+		"batch_remark":      batch.BatchRemark,
+		"total_amount":      batch.TotalAmount,
+		"total_num":         batch.TotalNum,
+		"success_amount":    batch.SuccessAmount,
+		"success_num":       batch.SuccessNum,
+		"fail_amount":       batch.FailAmount,
+		"fail_num":          batch.FailNum,
+		"transfer_scene_id": batch.TransferSceneID,
+		"create_time":       batch.CreatedAt.Format(time.RFC3339),
+		"update_time":       batch.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,154 @@
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outTradeNoPattern 商户订单号：6-32 位数字、大小写字母及 _-|*
+var outTradeNoPattern = regexp.MustCompile(`^[0-9A-Za-z_\-|*]{6,32}$`)
+
+// paramChecker 按微信支付 V3 规则依次校验请求 Body 参数，仅记录第一个错误
+// field 为 JSON Pointer 形式的字段路径，如 /amount/total
+type paramChecker struct {
+	field string
+	value interface{}
+	issue string
+}
+
+// fail 记录参数错误 (已有错误时忽略)
+func (p *paramChecker) fail(field string, value interface{}, issue string) {
+	if p.field == "" {
+		p.field, p.value, p.issue = field, value, issue
+	}
+}
+
+// str 校验字符串长度 (字节数)，min 为 0 表示选填
+func (p *paramChecker) str(field, value string, min, max int) {
+	switch {
+	case value == "" && min > 0:
+		p.fail(field, value, "字段必填")
+	case value != "" && len(value) < min:
+		p.fail(field, value, fmt.Sprintf("长度低于最小值 %d", min))
+	case len(value) > max:
+		p.fail(field, value, fmt.Sprintf("长度超过最大值 %d", max))
+	}
+}
+
+// outTradeNo 校验商户订单号
+func (p *paramChecker) outTradeNo(field, value string) {
+	if !outTradeNoPattern.MatchString(value) {
+		p.fail(field, value, "长度须为 6-32 位，且只能包含数字、大小写字母及 _-|*")
+	}
+}
+
+// amount 校验订单金额 (分) 及币种
+func (p *paramChecker) amount(field string, total int64, currency string) {
+	if total < 1 {
+		p.fail(field+"/total", total, "值低于最小值 1")
+	}
+	if currency != "" && currency != "CNY" {
+		p.fail(field+"/currency", currency, "仅支持 CNY")
+	}
+}
+
+// notifyUrl 校验回调地址：必须为 https 绝对地址，relaxed 时允许 http 地址或留空 (使用商户默认回调地址)
+func (p *paramChecker) notifyUrl(value string, relaxed bool) {
+	if value == "" && relaxed {
+		return
+	}
+	p.str("/notify_url", value, 1, 256)
+	if value == "" {
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		p.fail("/notify_url", value, "必须为完整的 URL 地址")
+		return
+	}
+	if u.Scheme != "https" && !(relaxed && u.Scheme == "http") {
+		p.fail("/notify_url", value, "必须为 https 地址")
+	}
+}
+
+// h5SceneInfo 校验 H5 支付场景信息
+func (p *paramChecker) h5SceneInfo(payerClientIP, h5Type string) {
+	p.str("/scene_info/payer_client_ip", payerClientIP, 1, 45)
+	p.str("/scene_info/h5_info/type", h5Type, 1, 32)
+	if h5Type != "" && !h5SceneTypes[h5Type] {
+		p.fail("/scene_info/h5_info/type", h5Type, "取值须为 iOS、Android 或 Wap")
+	}
+}
+
+// ok 无参数错误时返回 true；否则写入 PARAM_ERROR 响应 (detail 结构与微信支付一致)
+func (p *paramChecker) ok(c *gin.Context) bool {
+	if p.field == "" {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":    "PARAM_ERROR",
+		"message": fmt.Sprintf("输入源“/body%s”规则校验失败，%s", p.field, p.issue),
+		"detail": gin.H{
+			"field":    p.field,
+			"value":    p.value,
+			"issue":    p.issue,
+			"location": "body",
+		},
+	})
+	return false
+}
+
+// relaxedNotifyUrl 商户是否放宽 notify_url 校验 (商户不存在时按严格规则校验)
+func relaxedNotifyUrl(mchid string) bool {
+	var mch model.Merchant
+	return core.DB.Where("mch_id = ?", mchid).First(&mch).Error == nil && mch.RelaxNotifyUrl
+}
+
+// validatePrepay 校验下单参数 (普通商户及服务商模式)，失败时已写入错误响应
+func validatePrepay(c *gin.Context, tx model.Transaction) bool {
+	var p paramChecker
+
+	callerMchID := tx.MchID
+	if tx.SpMchID != "" {
+		callerMchID = tx.SpMchID
+		p.str("/sp_appid", tx.SpAppID, 1, 32)
+		p.str("/sp_mchid", tx.SpMchID, 1, 32)
+		p.str("/sub_appid", tx.AppID, 0, 32)
+		p.str("/sub_mchid", tx.MchID, 1, 32)
+	} else {
+		p.str("/appid", tx.AppID, 1, 32)
+		p.str("/mchid", tx.MchID, 1, 32)
+	}
+	p.str("/description", tx.Description, 1, 127)
+	p.outTradeNo("/out_trade_no", tx.OutTradeNo)
+
+	// 付款码支付无需回调地址，传入时仍需合法
+	if tx.TradeType != model.TradeTypeMicropay || tx.NotifyUrl != "" {
+		p.notifyUrl(tx.NotifyUrl, relaxedNotifyUrl(callerMchID))
+	}
+	p.amount("/amount", tx.Amount, tx.Currency)
+
+	if tx.TradeType == model.TradeTypeJSAPI {
+		if tx.SpMchID == "" {
+			p.str("/payer/openid", tx.PayerOpenID, 1, 128)
+		} else {
+			if tx.PayerOpenID == "" && tx.PayerSubOpenID == "" {
+				p.fail("/payer", nil, "sp_openid 和 sub_openid 必须二选一")
+			}
+			p.str("/payer/sp_openid", tx.PayerOpenID, 0, 128)
+			p.str("/payer/sub_openid", tx.PayerSubOpenID, 0, 128)
+			if tx.PayerSubOpenID != "" && tx.AppID == "" {
+				p.fail("/sub_appid", tx.AppID, "传入 sub_openid 时必填")
+			}
+		}
+	}
+
+	return p.ok(c)
+}
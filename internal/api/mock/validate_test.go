@@ -0,0 +1,161 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidatePrepay(t *testing.T) {
+	setupTestDB(t)
+	core.DB.Create(&model.Merchant{AppID: "wx_strict", MchID: "100"})
+	core.DB.Create(&model.Merchant{AppID: "wx_relaxed", MchID: "200", RelaxNotifyUrl: true})
+
+	jsapi := func(modify func(tx *model.Transaction)) model.Transaction {
+		tx := model.Transaction{
+			AppID:       "wx_strict",
+			MchID:       "100",
+			Description: "测试商品",
+			OutTradeNo:  "ORDER_000001",
+			NotifyUrl:   "https://example.com/notify",
+			Amount:      100,
+			PayerOpenID: "openid",
+			TradeType:   model.TradeTypeJSAPI,
+		}
+		if modify != nil {
+			modify(&tx)
+		}
+		return tx
+	}
+	partner := func(modify func(tx *model.Transaction)) model.Transaction {
+		return jsapi(func(tx *model.Transaction) {
+			tx.SpAppID, tx.SpMchID = "wx_sp", "100"
+			tx.AppID, tx.MchID = "", "300"
+			if modify != nil {
+				modify(tx)
+			}
+		})
+	}
+
+	tests := []struct {
+		name      string
+		tx        model.Transaction
+		wantField string // 为空表示校验通过
+	}{
+		{"valid jsapi", jsapi(nil), ""},
+		{"missing appid", jsapi(func(tx *model.Transaction) { tx.AppID = "" }), "/appid"},
+		{"mchid too long", jsapi(func(tx *model.Transaction) { tx.MchID = strings.Repeat("1", 33) }), "/mchid"},
+		{"missing description", jsapi(func(tx *model.Transaction) { tx.Description = "" }), "/description"},
+		{"description too long", jsapi(func(tx *model.Transaction) { tx.Description = strings.Repeat("a", 128) }), "/description"},
+		{"out_trade_no too short", jsapi(func(tx *model.Transaction) { tx.OutTradeNo = "abc" }), "/out_trade_no"},
+		{"out_trade_no invalid char", jsapi(func(tx *model.Transaction) { tx.OutTradeNo = "ORDER#0001" }), "/out_trade_no"},
+		{"out_trade_no special chars", jsapi(func(tx *model.Transaction) { tx.OutTradeNo = "A_b-1|2*3" }), ""},
+		{"zero amount", jsapi(func(tx *model.Transaction) { tx.Amount = 0 }), "/amount/total"},
+		{"unsupported currency", jsapi(func(tx *model.Transaction) { tx.Currency = "USD" }), "/amount/currency"},
+		{"missing notify_url", jsapi(func(tx *model.Transaction) { tx.NotifyUrl = "" }), "/notify_url"},
+		{"relative notify_url", jsapi(func(tx *model.Transaction) { tx.NotifyUrl = "/notify" }), "/notify_url"},
+		{"http notify_url", jsapi(func(tx *model.Transaction) { tx.NotifyUrl = "http://example.com/notify" }), "/notify_url"},
+		{"relaxed http notify_url", jsapi(func(tx *model.Transaction) {
+			tx.AppID, tx.MchID, tx.NotifyUrl = "wx_relaxed", "200", "http://localhost/notify"
+		}), ""},
+		{"relaxed empty notify_url", jsapi(func(tx *model.Transaction) { tx.AppID, tx.MchID, tx.NotifyUrl = "wx_relaxed", "200", "" }), ""},
+		{"jsapi missing openid", jsapi(func(tx *model.Transaction) { tx.PayerOpenID = "" }), "/payer/openid"},
+		{"native without openid", jsapi(func(tx *model.Transaction) { tx.PayerOpenID, tx.TradeType = "", model.TradeTypeNative }), ""},
+		{"micropay without notify_url", jsapi(func(tx *model.Transaction) {
+			tx.PayerOpenID, tx.NotifyUrl, tx.TradeType = "", "", model.TradeTypeMicropay
+		}), ""},
+		{"valid partner", partner(nil), ""},
+		{"partner missing sub_mchid", partner(func(tx *model.Transaction) { tx.MchID = "" }), "/sub_mchid"},
+		{"partner missing sp_appid", partner(func(tx *model.Transaction) { tx.SpAppID = "" }), "/sp_appid"},
+		{"partner missing payer", partner(func(tx *model.Transaction) { tx.PayerOpenID = "" }), "/payer"},
+		{"partner sub_openid without sub_appid", partner(func(tx *model.Transaction) {
+			tx.PayerOpenID, tx.PayerSubOpenID = "", "sub_openid"
+		}), "/sub_appid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			ok := validatePrepay(c, tt.tx)
+			if tt.wantField == "" {
+				if !ok {
+					t.Fatalf("validatePrepay failed: %s", w.Body.String())
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("validatePrepay passed, want PARAM_ERROR on %s", tt.wantField)
+			}
+
+			var resp struct {
+				Code   string `json:"code"`
+				Detail struct {
+					Field    string `json:"field"`
+					Location string `json:"location"`
+				} `json:"detail"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+			}
+			if w.Code != http.StatusBadRequest || resp.Code != "PARAM_ERROR" {
+				t.Errorf("response = %d %s, want 400 PARAM_ERROR", w.Code, resp.Code)
+			}
+			if resp.Detail.Field != tt.wantField || resp.Detail.Location != "body" {
+				t.Errorf("detail = %+v, want field %s in body", resp.Detail, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidateCombineSubOrders(t *testing.T) {
+	setupTestDB(t)
+
+	combine := func(subs ...[2]string) CombinePrepayRequest {
+		req := CombinePrepayRequest{
+			CombineAppID:      "wx_combine",
+			CombineMchid:      "100",
+			CombineOutTradeNo: "COMBINE_000001",
+			NotifyUrl:         "https://example.com/notify",
+		}
+		req.CombinePayerInfo.OpenID = "openid"
+		for _, s := range subs {
+			sub := CombineSubOrder{Mchid: s[0], OutTradeNo: s[1], Description: "子单"}
+			sub.Amount.TotalAmount = 100
+			req.SubOrders = append(req.SubOrders, sub)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		req       CombinePrepayRequest
+		wantField string // 为空表示校验通过
+	}{
+		{"distinct sub orders", combine([2]string{"200", "ORDER_000001"}, [2]string{"200", "ORDER_000002"}), ""},
+		{"same out_trade_no on different mchids", combine([2]string{"200", "ORDER_000001"}, [2]string{"300", "ORDER_000001"}), ""},
+		{"duplicate sub order", combine([2]string{"200", "ORDER_000001"}, [2]string{"200", "ORDER_000001"}), "/sub_orders/1/out_trade_no"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		ok := validateCombine(c, tt.req, model.TradeTypeJSAPI)
+		if tt.wantField == "" {
+			if !ok {
+				t.Errorf("%s: validateCombine failed: %s", tt.name, w.Body.String())
+			}
+			continue
+		}
+		if ok || !strings.Contains(w.Body.String(), `"field":"`+tt.wantField+`"`) {
+			t.Errorf("%s: response = %s, want PARAM_ERROR on %s", tt.name, w.Body.String(), tt.wantField)
+		}
+	}
+}
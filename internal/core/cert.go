@@ -0,0 +1,233 @@
+package core
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// platformCertLock 防止并发请求为同一商户重复生成证书
+var platformCertLock sync.Mutex
+
+// GetPlatformCert 获取商户当前生效的平台证书，不存在时自动生成
+func GetPlatformCert(mchid string) (model.PlatformCert, error) {
+	platformCertLock.Lock()
+	defer platformCertLock.Unlock()
+
+	var cert model.PlatformCert
+	err := DB.Where("mch_id = ?", mchid).Order("effective_time desc, id desc").First(&cert).Error
+	if err == nil {
+		return cert, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return cert, err
+	}
+	return generatePlatformCert(mchid)
+}
+
+// ListPlatformCerts 获取商户所有未过期的平台证书 (按生效时间倒序)，不存在时自动生成
+func ListPlatformCerts(mchid string) ([]model.PlatformCert, error) {
+	if _, err := GetPlatformCert(mchid); err != nil {
+		return nil, err
+	}
+
+	var certs []model.PlatformCert
+	err := DB.Where("mch_id = ? AND expire_time > ?", mchid, time.Now()).
+		Order("effective_time desc, id desc").Find(&certs).Error
+	return certs, err
+}
+
+// RotatePlatformCert 为商户生成新的平台证书，新证书成为当前生效证书
+func RotatePlatformCert(mchid string) (model.PlatformCert, error) {
+	platformCertLock.Lock()
+	defer platformCertLock.Unlock()
+
+	return generatePlatformCert(mchid)
+}
+
+// generatePlatformCert 生成 RSA 2048 自签名证书并持久化
+func generatePlatformCert(mchid string) (model.PlatformCert, error) {
+	var cert model.PlatformCert
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return cert, err
+	}
+
+	// 微信支付证书序列号为 40 位十六进制串
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return cert, err
+	}
+	serial.Add(serial, new(big.Int).Lsh(big.NewInt(1), 156))
+
+	now := time.Now().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         "Tenpay.com sign",
+			Organization:       []string{"Pay Sandbox"},
+			OrganizationalUnit: []string{mchid},
+		},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return cert, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return cert, err
+	}
+
+	cert = model.PlatformCert{
+		MchID:         mchid,
+		SerialNo:      strings.ToUpper(fmt.Sprintf("%040x", serial)),
+		PrivateKey:    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		EffectiveTime: template.NotBefore,
+		ExpireTime:    template.NotAfter,
+	}
+	if err := DB.Create(&cert).Error; err != nil {
+		return cert, err
+	}
+	return cert, nil
+}
+
+// SignWithPlatformCert 使用平台证书私钥对消息进行 SHA256-RSA2048 签名，返回 Base64 编码签名
+func SignWithPlatformCert(cert model.PlatformCert, message string) (string, error) {
+	block, _ := pem.Decode([]byte(cert.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key of platform cert %s", cert.SerialNo)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("platform cert %s is not an RSA key", cert.SerialNo)
+	}
+
+	hashed := sha256.Sum256([]byte(message))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// DecryptSensitive 使用商户平台证书私钥解密敏感字段 (RSAES-OAEP)
+// 依次尝试商户所有平台证书，均无法解密时视为明文原样返回
+func DecryptSensitive(mchid, ciphertext string) string {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return ciphertext
+	}
+
+	var certs []model.PlatformCert
+	DB.Where("mch_id = ?", mchid).Find(&certs)
+	for _, cert := range certs {
+		block, _ := pem.Decode([]byte(cert.PrivateKey))
+		if block == nil {
+			continue
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			continue
+		}
+		if plaintext, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data, nil); err == nil {
+			return string(plaintext)
+		}
+	}
+	return ciphertext
+}
+
+// ParseRSAPublicKey 解析 PEM 格式的证书或公钥，证书时同时返回其序列号
+func ParseRSAPublicKey(pemStr string) (*rsa.PublicKey, string, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, "", errors.New("invalid PEM data")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, "", errors.New("certificate is not an RSA key")
+		}
+		return pub, strings.ToUpper(fmt.Sprintf("%x", cert.SerialNumber)), nil
+	default:
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		pub, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, "", errors.New("public key is not an RSA key")
+		}
+		return pub, "", nil
+	}
+}
+
+// VerifySHA256RSA 校验 Base64 编码的 SHA256-RSA2048 签名
+func VerifySHA256RSA(pub *rsa.PublicKey, message, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(message))
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig)
+}
+
+// SignatureHeaders 按 V3 规范生成 Wechatpay-* 签名头
+// 签名串格式为: 时间戳\n随机串\n报文主体\n
+func SignatureHeaders(mchid string, body []byte) (map[string]string, error) {
+	cert, err := GetPlatformCert(mchid)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	nonce := RandomString(32)
+	signature, err := SignWithPlatformCert(cert, timestamp+"\n"+nonce+"\n"+string(body)+"\n")
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"Wechatpay-Timestamp":      timestamp,
+		"Wechatpay-Nonce":          nonce,
+		"Wechatpay-Signature":      signature,
+		"Wechatpay-Serial":         cert.SerialNo,
+		"Wechatpay-Signature-Type": "WECHATPAY2-SHA256-RSA2048",
+	}, nil
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// PublicURL 沙箱服务对外访问地址 (用于生成 code_url 等链接)，为空时根据请求 Host 推导
+	PublicURL string
+	// WebURL 前端页面访问地址 (支付模拟页)，为空时使用请求主机的 3000 端口
+	WebURL string
+)
+
+// requestScheme 获取请求协议，兼容反向代理
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// PublicBaseURL 获取沙箱服务对外访问的基础地址
+func PublicBaseURL(r *http.Request) string {
+	if PublicURL != "" {
+		return strings.TrimRight(PublicURL, "/")
+	}
+	return requestScheme(r) + "://" + r.Host
+}
+
+// WebBaseURL 获取前端页面的基础地址
+func WebBaseURL(r *http.Request) string {
+	if WebURL != "" {
+		return strings.TrimRight(WebURL, "/")
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return requestScheme(r) + "://" + net.JoinHostPort(host, "3000")
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+const nonceChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// RandomString 生成指定长度的随机字母数字串 (用于 nonce 等)
+func RandomString(n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(nonceChars)))
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = nonceChars[idx.Int64()]
+	}
+	return string(b)
+}
+
+// EncryptAESGCM 使用 AEAD_AES_256_GCM 加密，返回 Base64 编码的密文 (含 16 字节认证标签)
+// key 为商户 APIv3 密钥 (32 字节)，nonce 为 12 字节随机串
+func EncryptAESGCM(key, nonce, associatedData string, plaintext []byte) (string, error) {
+	if len(key) != 32 {
+		return "", fmt.Errorf("invalid APIv3 key length %d, must be 32 bytes", len(key))
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, []byte(nonce), plaintext, []byte(associatedData))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptAESGCM 解密 AEAD_AES_256_GCM 密文 (Base64 编码)
+func DecryptAESGCM(key, nonce, associatedData, ciphertext string) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid APIv3 key length %d, must be 32 bytes", len(key))
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, []byte(nonce), data, []byte(associatedData))
+}
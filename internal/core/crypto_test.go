@@ -0,0 +1,48 @@
+package core
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestAESGCMRoundTrip(t *testing.T) {
+	key := "01234567890123456789012345678901"
+	nonce := RandomString(12)
+	plaintext := []byte(`{"transaction_id":"4200000001","trade_state":"SUCCESS"}`)
+
+	ciphertext, err := EncryptAESGCM(key, nonce, "transaction", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecryptAESGCM(key, nonce, "transaction", ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(plaintext) {
+		t.Errorf("decrypted = %s, want %s", got, plaintext)
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(ciphertext)
+	data[0] ^= 0xff
+	tampered := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name                                   string
+		key, nonce, associatedData, ciphertext string
+	}{
+		{"wrong key", strings.Repeat("x", 32), nonce, "transaction", ciphertext},
+		{"wrong nonce", key, RandomString(12), "transaction", ciphertext},
+		{"wrong associated_data", key, nonce, "refund", ciphertext},
+		{"tampered ciphertext", key, nonce, "transaction", tampered},
+		{"short key", key[:16], nonce, "transaction", ciphertext},
+	}
+	for _, tt := range tests {
+		if _, err := DecryptAESGCM(tt.key, tt.nonce, tt.associatedData, tt.ciphertext); err == nil {
+			t.Errorf("%s: decrypt succeeded, want error", tt.name)
+		}
+	}
+	if _, err := EncryptAESGCM(key[:31], nonce, "transaction", plaintext); err == nil {
+		t.Error("31-byte key: encrypt succeeded, want error")
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"log"
 	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -23,11 +24,69 @@ func InitDB(dsn string) {
 	// 自动迁移
 	err = DB.AutoMigrate(
 		&model.Merchant{},
+		&model.MerchantAppID{},
 		&model.Transaction{},
 		&model.CallbackLog{},
 		&model.Refund{},
+		&model.PlatformCert{},
+		&model.CombineOrder{},
+		&model.ProfitSharingReceiver{},
+		&model.ProfitSharingOrder{},
+		&model.ProfitSharingDetail{},
+		&model.ProfitSharingReturn{},
+		&model.TransferBatch{},
+		&model.TransferDetail{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+
+	// 商户订单号、退款单号及分账单号改为商户内唯一，删除旧版本的全局索引 (新的联合唯一索引已由 AutoMigrate 创建)
+	for table, index := range map[interface{}]string{
+		&model.Transaction{}:         "idx_transactions_out_trade_no",
+		&model.Refund{}:              "idx_refunds_out_refund_no",
+		&model.CombineOrder{}:        "idx_combine_orders_combine_out_trade_no",
+		&model.ProfitSharingOrder{}:  "idx_profit_sharing_orders_out_order_no",
+		&model.ProfitSharingReturn{}: "idx_profit_sharing_returns_out_return_no",
+	} {
+		if DB.Migrator().HasIndex(table, index) {
+			if err := DB.Migrator().DropIndex(table, index); err != nil {
+				log.Fatalf("Failed to drop index %s: %v", index, err)
+			}
+		}
+	}
+
+	// 历史交易记录的交易类型统一为微信支付 trade_type
+	for legacy, tradeType := range map[string]string{
+		"":           model.TradeTypeJSAPI,
+		"WX:JSAPI":   model.TradeTypeJSAPI,
+		"WX:M_JSAPI": model.TradeTypeJSAPI,
+		"WX:APP":     model.TradeTypeApp,
+		"WX:NATIVE":  model.TradeTypeNative,
+		"WX:MWEB":    model.TradeTypeMWeb,
+	} {
+		DB.Model(&model.Transaction{}).Where("trade_type = ?", legacy).Update("trade_type", tradeType)
+	}
+
+	// 历史未支付订单状态 CREATED 统一为微信支付 trade_state NOTPAY
+	DB.Model(&model.Transaction{}).Where("status = ?", "CREATED").Update("status", tradestate.NotPay)
+	DB.Model(&model.CombineOrder{}).Where("status = ?", "CREATED").Update("status", tradestate.NotPay)
+
+	// 旧版本未设置 time_expire 的未支付订单按下单时间补齐默认有效期，由过期任务关闭
+	var txs []model.Transaction
+	DB.Select("id", "created_at").Where("time_expire IS NULL AND status IN ?", tradestate.Sources(tradestate.Closed)).Find(&txs)
+	for _, tx := range txs {
+		DB.Model(&tx).UpdateColumn("time_expire", tx.CreatedAt.Add(model.DefaultTimeExpire))
+	}
+	var orders []model.CombineOrder
+	DB.Select("id", "created_at").Where("time_expire IS NULL AND status = ?", tradestate.NotPay).Find(&orders)
+	for _, order := range orders {
+		DB.Model(&order).UpdateColumn("time_expire", order.CreatedAt.Add(model.DefaultTimeExpire))
+	}
+
+	// 历史退款记录补齐退款渠道
+	DB.Model(&model.Refund{}).Where("channel = '' OR channel IS NULL").Updates(map[string]interface{}{
+		"channel":               "ORIGINAL",
+		"user_received_account": "支付用户零钱",
+	})
 }
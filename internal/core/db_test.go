@@ -0,0 +1,150 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// 旧版本表结构：商户单号为全局唯一 (分账单号为普通索引)
+
+type legacyTransaction struct {
+	ID            uint
+	MchID         string `gorm:"index"`
+	OutTradeNo    string `gorm:"uniqueIndex;not null"`
+	TransactionID string `gorm:"uniqueIndex;not null"`
+	Status        string
+	TradeType     string
+	TimeExpire    *time.Time
+	CreatedAt     time.Time
+}
+
+func (legacyTransaction) TableName() string { return "transactions" }
+
+type legacyRefund struct {
+	ID            uint
+	RefundID      string `gorm:"uniqueIndex;not null"`
+	OutRefundNo   string `gorm:"uniqueIndex;not null"`
+	TransactionID string `gorm:"index;not null"`
+	MchID         string `gorm:"index"`
+}
+
+func (legacyRefund) TableName() string { return "refunds" }
+
+type legacyCombineOrder struct {
+	ID                uint
+	CombineMchID      string `gorm:"index"`
+	CombineOutTradeNo string `gorm:"uniqueIndex;not null"`
+	Status            string
+}
+
+func (legacyCombineOrder) TableName() string { return "combine_orders" }
+
+type legacyProfitSharingOrder struct {
+	ID            uint
+	OrderID       string `gorm:"uniqueIndex;not null"`
+	OutOrderNo    string `gorm:"index;not null"`
+	TransactionID string `gorm:"index;not null"`
+	MchID         string `gorm:"index"`
+}
+
+func (legacyProfitSharingOrder) TableName() string { return "profit_sharing_orders" }
+
+type legacyProfitSharingReturn struct {
+	ID          uint
+	ReturnID    string `gorm:"uniqueIndex;not null"`
+	OutReturnNo string `gorm:"index;not null"`
+	OrderID     string `gorm:"index;not null"`
+	MchID       string `gorm:"index"`
+}
+
+func (legacyProfitSharingReturn) TableName() string { return "profit_sharing_returns" }
+
+func TestInitDBMigratesLegacySchema(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "sandbox.db")
+
+	legacy, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.AutoMigrate(&legacyTransaction{}, &legacyRefund{}, &legacyCombineOrder{},
+		&legacyProfitSharingOrder{}, &legacyProfitSharingReturn{}); err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	legacy.Create(&legacyTransaction{MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000001", Status: "CREATED", TradeType: "WX:APP", CreatedAt: createdAt})
+	legacy.Create(&legacyTransaction{MchID: "100", OutTradeNo: "ORDER_2", TransactionID: "4200000002", Status: tradestate.Success, TradeType: "WX:NATIVE", CreatedAt: createdAt})
+	legacy.Create(&legacyRefund{RefundID: "5030000001", OutRefundNo: "REFUND_1", TransactionID: "4200000002", MchID: "100"})
+	if db, _ := legacy.DB(); db != nil {
+		db.Close()
+	}
+
+	InitDB(dsn)
+
+	indexes := []struct {
+		table interface{}
+		name  string
+		want  bool
+	}{
+		{&model.Transaction{}, "idx_transactions_out_trade_no", false},
+		{&model.Transaction{}, "idx_out_trade_no", true},
+		{&model.Refund{}, "idx_refunds_out_refund_no", false},
+		{&model.Refund{}, "idx_out_refund_no", true},
+		{&model.CombineOrder{}, "idx_combine_orders_combine_out_trade_no", false},
+		{&model.CombineOrder{}, "idx_combine_out_trade_no", true},
+		{&model.ProfitSharingOrder{}, "idx_profit_sharing_orders_out_order_no", false},
+		{&model.ProfitSharingOrder{}, "idx_ps_out_order_no", true},
+		{&model.ProfitSharingReturn{}, "idx_profit_sharing_returns_out_return_no", false},
+		{&model.ProfitSharingReturn{}, "idx_ps_out_return_no", true},
+	}
+	for _, idx := range indexes {
+		if got := DB.Migrator().HasIndex(idx.table, idx.name); got != idx.want {
+			t.Errorf("HasIndex(%s) = %v, want %v", idx.name, got, idx.want)
+		}
+	}
+
+	// 商户单号改为商户内唯一
+	uniques := []struct {
+		name    string
+		record  interface{}
+		wantErr bool
+	}{
+		{"out_trade_no on another merchant", &model.Transaction{MchID: "200", OutTradeNo: "ORDER_1", TransactionID: "4200000003"}, false},
+		{"out_trade_no on same merchant", &model.Transaction{MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000004"}, true},
+		{"out_refund_no on another merchant", &model.Refund{RefundID: "5030000002", OutRefundNo: "REFUND_1", TransactionID: "4200000003", MchID: "200"}, false},
+		{"out_refund_no on same merchant", &model.Refund{RefundID: "5030000003", OutRefundNo: "REFUND_1", TransactionID: "4200000002", MchID: "100"}, true},
+		{"out_order_no on first merchant", &model.ProfitSharingOrder{OrderID: "3008000001", OutOrderNo: "PS_1", TransactionID: "4200000002", MchID: "100"}, false},
+		{"out_order_no on another merchant", &model.ProfitSharingOrder{OrderID: "3008000002", OutOrderNo: "PS_1", TransactionID: "4200000003", MchID: "200"}, false},
+		{"out_order_no on same merchant", &model.ProfitSharingOrder{OrderID: "3008000003", OutOrderNo: "PS_1", TransactionID: "4200000002", MchID: "100"}, true},
+	}
+	for _, u := range uniques {
+		if err := DB.Create(u.record).Error; (err != nil) != u.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", u.name, err, u.wantErr)
+		}
+	}
+
+	// 历史数据迁移：交易类型、CREATED 状态及缺失的 time_expire
+	var unpaid, paid model.Transaction
+	DB.Where("transaction_id = ?", "4200000001").First(&unpaid)
+	DB.Where("transaction_id = ?", "4200000002").First(&paid)
+	if unpaid.Status != tradestate.NotPay || unpaid.TradeType != model.TradeTypeApp || paid.TradeType != model.TradeTypeNative {
+		t.Errorf("migrated orders = %s/%s, %s", unpaid.Status, unpaid.TradeType, paid.TradeType)
+	}
+	if unpaid.TimeExpire == nil || !unpaid.TimeExpire.Equal(createdAt.Add(model.DefaultTimeExpire)) {
+		t.Errorf("unpaid time_expire = %v, want %v", unpaid.TimeExpire, createdAt.Add(model.DefaultTimeExpire))
+	}
+	if paid.TimeExpire != nil {
+		t.Errorf("paid time_expire = %v, want nil", paid.TimeExpire)
+	}
+
+	var refund model.Refund
+	DB.Where("refund_id = ?", "5030000001").First(&refund)
+	if refund.Channel != "ORIGINAL" {
+		t.Errorf("refund channel = %q, want ORIGINAL", refund.Channel)
+	}
+}
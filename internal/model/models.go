@@ -8,39 +8,109 @@ import (
 
 // Merchant 商户配置
 type Merchant struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	AppID           string         `gorm:"uniqueIndex;not null" json:"appid"`
-	MchID           string         `gorm:"uniqueIndex;not null" json:"mchid"`
-	APIV3Key        string         `gorm:"not null" json:"api_v3_key"`
-	Description     string         `json:"description"`
-	NotifyConfig    string         `gorm:"type:text" json:"notify_config"` // JSON string: {"interval": "1m", "max_retries": 3}
-	NotifyUrl       string         `json:"notify_url"`                     // 默认回调地址
-	RefundNotifyUrl string         `json:"refund_notify_url"`              // 退款回调地址
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	AppID            string         `gorm:"uniqueIndex;not null" json:"appid"`
+	MchID            string         `gorm:"uniqueIndex;not null" json:"mchid"`
+	APIV3Key         string         `gorm:"not null" json:"api_v3_key"`
+	Description      string         `json:"description"`
+	NotifyConfig     string         `gorm:"type:text" json:"notify_config"`   // JSON string: {"interval": "1m", "max_retries": 3}
+	NotifyUrl        string         `json:"notify_url"`                       // 默认回调地址
+	RefundNotifyUrl  string         `json:"refund_notify_url"`                // 退款回调地址
+	NotifyDebug      bool           `json:"notify_debug"`                     // 调试模式：回调报文额外附带明文字段
+	RefundWindowDays int            `json:"refund_window_days"`               // 可退款期限 (天)，0 表示默认 365 天
+	RefundConfig     string         `gorm:"type:text" json:"refund_config"`   // JSON string: {"delay": "5s", "result": "SUCCESS"}
+	StrictSign       bool           `json:"strict_sign"`                      // 严格模式：校验请求 Authorization 签名
+	RelaxNotifyUrl   bool           `json:"relax_notify_url"`                 // 放宽下单 notify_url 校验：允许 http 地址或留空 (使用默认回调地址)
+	ClientSerialNo   string         `json:"client_serial_no"`                 // 商户 API 证书序列号
+	ClientCert       string         `gorm:"type:text" json:"client_cert"`     // 商户 API 证书或公钥 (PEM)
+	ParentMchID      string         `gorm:"index" json:"parent_mchid"`        // 所属服务商商户号，非空表示该商户为特约商户 (sub_mchid)
+	TransferConfig   string         `gorm:"type:text" json:"transfer_config"` // JSON string: {"delay": "3s", "result": "SUCCESS", "fail_reason": "", "fail_openids": {"openid": "ACCOUNT_FROZEN"}}
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// MerchantAppID 商户号绑定的其他 appid，下单时 appid 须为商户自身的 AppID 或已绑定的 appid
+type MerchantAppID struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	MchID       string    `gorm:"uniqueIndex:idx_mch_appid;not null" json:"mchid"`
+	AppID       string    `gorm:"uniqueIndex:idx_mch_appid;not null" json:"appid"`
+	Description string    `json:"description"` // 应用说明，如小程序、APP
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DefaultTimeExpire 下单未指定 time_expire 时的订单有效期 (与微信支付一致为 2 小时)
+const DefaultTimeExpire = 2 * time.Hour
+
+// 交易类型 (trade_type)，由下单接口决定
+const (
+	TradeTypeJSAPI    = "JSAPI"    // 公众号支付、小程序支付
+	TradeTypeNative   = "NATIVE"   // Native 扫码支付
+	TradeTypeApp      = "APP"      // APP 支付
+	TradeTypeMWeb     = "MWEB"     // H5 支付
+	TradeTypeMicropay = "MICROPAY" // 付款码支付
+	TradeTypeFacepay  = "FACEPAY"  // 刷脸支付
+)
+
+// IsValidTradeType 校验交易类型是否合法
+func IsValidTradeType(tradeType string) bool {
+	switch tradeType {
+	case TradeTypeJSAPI, TradeTypeNative, TradeTypeApp, TradeTypeMWeb, TradeTypeMicropay, TradeTypeFacepay:
+		return true
+	}
+	return false
 }
 
 // Transaction 交易订单
 type Transaction struct {
-	ID             uint       `gorm:"primaryKey" json:"id"`
-	AppID          string     `gorm:"index" json:"appid"`
-	MchID          string     `gorm:"index" json:"mchid"`
-	Description    string     `json:"description"`
-	OutTradeNo     string     `gorm:"uniqueIndex;not null" json:"out_trade_no"`
-	TransactionID  string     `gorm:"uniqueIndex;not null" json:"transaction_id"` // 微信侧单号
-	PrepayID       string     `gorm:"index" json:"prepay_id"`                     // 预支付ID
-	Amount         int64      `json:"amount"`                                     // 分
-	Currency       string     `json:"currency"`
-	PayerOpenID    string     `json:"payer_openid"`
-	Status         string     `gorm:"index" json:"status"` // CREATED, SUCCESS, REFUND, CLOSED
-	NotifyUrl      string     `json:"notify_url"`
-	CallbackStatus string     `json:"callback_status"` // SUCCESS, FAIL
-	CallbackMsg    string     `json:"callback_msg"`    // 失败原因
-	TradeType      string     `json:"trade_type"`      // JSAPI
-	PaidAt         *time.Time `json:"paid_at"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	AppID            string     `gorm:"index" json:"appid"`
+	MchID            string     `gorm:"index;uniqueIndex:idx_out_trade_no" json:"mchid"`
+	Description      string     `json:"description"`
+	OutTradeNo       string     `gorm:"uniqueIndex:idx_out_trade_no;not null" json:"out_trade_no"` // 商户订单号 (商户内唯一)
+	TransactionID    string     `gorm:"uniqueIndex;not null" json:"transaction_id"`                // 微信侧单号
+	PrepayID         string     `gorm:"index" json:"prepay_id"`                                    // 预支付ID (合单子单为空，使用合单的预支付ID)
+	Attach           string     `json:"attach"`                                                    // 附加数据
+	Amount           int64      `json:"amount"`                                                    // 分
+	Currency         string     `json:"currency"`
+	PayerOpenID      string     `json:"payer_openid"`
+	PayerSubOpenID   string     `json:"payer_sub_openid"`      // 服务商模式：用户在子商户 appid 下的 openid
+	SpAppID          string     `json:"sp_appid"`              // 服务商模式：服务商应用ID
+	SpMchID          string     `gorm:"index" json:"sp_mchid"` // 服务商模式：服务商商户号 (MchID 为特约商户号)
+	Status           string     `gorm:"index" json:"status"`   // trade_state: NOTPAY, USERPAYING, SUCCESS, PAYERROR, REFUND, CLOSED, REVOKED (见 tradestate)
+	NotifyUrl        string     `json:"notify_url"`
+	CallbackStatus   string     `json:"callback_status"`         // SUCCESS, FAIL
+	CallbackMsg      string     `json:"callback_msg"`            // 失败原因
+	TradeType        string     `gorm:"index" json:"trade_type"` // JSAPI, NATIVE, APP, MWEB, MICROPAY, FACEPAY
+	PaidAt           *time.Time `json:"paid_at"`
+	TimeExpire       *time.Time `gorm:"index" json:"time_expire"`   // 支付有效期，超过后未支付订单自动关闭
+	CombineID        uint       `gorm:"index" json:"combine_id"`    // 所属合单 ID，0 表示非合单子单
+	ProfitSharing    bool       `json:"profit_sharing"`             // 下单时指定分账 (settle_info.profit_sharing)
+	RefundedAmount   int64      `gorm:"-" json:"refunded_amount"`   // 累计已退款金额 (查询时计算)
+	RefundableAmount int64      `gorm:"-" json:"refundable_amount"` // 剩余可退款金额 (查询时计算)
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// CombineOrder 合单支付订单，每笔子单为一条关联的 Transaction
+type CombineOrder struct {
+	ID                uint          `gorm:"primaryKey" json:"id"`
+	CombineAppID      string        `gorm:"index" json:"combine_appid"`
+	CombineMchID      string        `gorm:"index;uniqueIndex:idx_combine_out_trade_no" json:"combine_mchid"`
+	CombineOutTradeNo string        `gorm:"uniqueIndex:idx_combine_out_trade_no;not null" json:"combine_out_trade_no"` // 合单商户订单号 (商户内唯一)
+	PrepayID          string        `gorm:"index" json:"prepay_id"`                                                    // 合单的预支付ID，子单按 combine_id 关联
+	TradeType         string        `json:"trade_type"`
+	PayerOpenID       string        `json:"payer_openid"`
+	SceneInfo         string        `gorm:"type:text" json:"scene_info"` // 下单时的 scene_info (JSON 原文)
+	NotifyUrl         string        `json:"notify_url"`
+	Status            string        `gorm:"index" json:"status"` // NOTPAY, SUCCESS, CLOSED
+	CallbackStatus    string        `json:"callback_status"`     // SUCCESS, FAIL
+	CallbackMsg       string        `json:"callback_msg"`        // 失败原因
+	PaidAt            *time.Time    `json:"paid_at"`
+	TimeExpire        *time.Time    `gorm:"index" json:"time_expire"` // 支付有效期，超过后合单及子单自动关闭
+	SubOrders         []Transaction `gorm:"foreignKey:CombineID" json:"sub_orders,omitempty"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
 }
 
 // CallbackLog 回调日志
@@ -51,26 +121,149 @@ type CallbackLog struct {
 	RequestBody   string    `gorm:"type:text" json:"request_body"`
 	ResponseBody  string    `gorm:"type:text" json:"response_body"`
 	StatusCode    int       `json:"status_code"`
-	Status        string    `json:"status"` // SUCCESS, FAIL
+	EventType     string    `gorm:"index" json:"event_type"` // TRANSACTION.SUCCESS, REFUND.SUCCESS 等
+	Status        string    `json:"status"`                  // SUCCESS, FAIL
 	RetryCount    int       `json:"retry_count"`
 	CreatedAt     time.Time `json:"created_at"`
 }
 
 // Refund 退款记录
 type Refund struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	RefundID            string     `gorm:"uniqueIndex;not null" json:"refund_id"`                       // 微信退款单号
+	OutRefundNo         string     `gorm:"uniqueIndex:idx_out_refund_no;not null" json:"out_refund_no"` // 商户退款单号 (商户内唯一)
+	TransactionID       string     `gorm:"index;not null" json:"transaction_id"`                        // 关联支付订单号
+	MchID               string     `gorm:"index;uniqueIndex:idx_out_refund_no" json:"mchid"`
+	SpMchID             string     `gorm:"index" json:"sp_mchid"` // 服务商模式：服务商商户号 (MchID 为特约商户号)
+	Amount              int64      `json:"amount"`                // 退款金额
+	Total               int64      `json:"total"`                 // 原订单总金额
+	Currency            string     `json:"currency"`
+	Reason              string     `json:"reason"`
+	Status              string     `json:"status"`                // PROCESSING, SUCCESS, ABNORMAL, CLOSED
+	FundsAccount        string     `json:"funds_account"`         // 资金账户：AVAILABLE, UNSETTLED 等
+	Channel             string     `json:"channel"`               // 退款渠道：ORIGINAL, BALANCE, OTHER_BALANCE, OTHER_BANKCARD
+	UserReceivedAccount string     `json:"user_received_account"` // 退款入账账户
+	NotifyUrl           string     `json:"notify_url"`
+	CallbackStatus      string     `json:"callback_status"` // SUCCESS, FAIL
+	CallbackMsg         string     `json:"callback_msg"`    // 失败原因
+	SuccessAt           *time.Time `json:"success_time"`    // 退款成功时间
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// PlatformCert 沙箱平台证书 (每个商户独立生成，用于回调及应答签名)
+type PlatformCert struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	MchID         string    `gorm:"index;not null" json:"mchid"`
+	SerialNo      string    `gorm:"uniqueIndex;not null" json:"serial_no"` // 证书序列号
+	PrivateKey    string    `gorm:"type:text" json:"-"`                    // PEM 格式私钥
+	Certificate   string    `gorm:"type:text" json:"certificate"`          // PEM 格式证书
+	EffectiveTime time.Time `json:"effective_time"`
+	ExpireTime    time.Time `json:"expire_time"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ProfitSharingReceiver 分账接收方 (由分账方商户添加)
+type ProfitSharingReceiver struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
-	RefundID       string    `gorm:"uniqueIndex;not null" json:"refund_id"`     // 微信退款单号
-	OutRefundNo    string    `gorm:"uniqueIndex;not null" json:"out_refund_no"` // 商户退款单号
-	TransactionID  string    `gorm:"index;not null" json:"transaction_id"`      // 关联支付订单号
-	MchID          string    `gorm:"index" json:"mchid"`
-	Amount         int64     `json:"amount"` // 退款金额
-	Total          int64     `json:"total"`  // 原订单总金额
-	Currency       string    `json:"currency"`
-	Reason         string    `json:"reason"`
-	Status         string    `json:"status"` // SUCCESS, PROCESSING, ABNORMAL
-	NotifyUrl      string    `json:"notify_url"`
-	CallbackStatus string    `json:"callback_status"` // SUCCESS, FAIL
-	CallbackMsg    string    `json:"callback_msg"`    // 失败原因
+	MchID          string    `gorm:"uniqueIndex:idx_receiver;not null" json:"mchid"` // 添加接收方的商户号 (服务商模式为特约商户号)
+	SpMchID        string    `gorm:"index" json:"sp_mchid"`
+	AppID          string    `json:"appid"`
+	Type           string    `gorm:"uniqueIndex:idx_receiver;not null" json:"type"`    // MERCHANT_ID, PERSONAL_OPENID, PERSONAL_SUB_OPENID
+	Account        string    `gorm:"uniqueIndex:idx_receiver;not null" json:"account"` // 商户号或 openid
+	Name           string    `json:"name"`
+	RelationType   string    `json:"relation_type"` // STORE, STAFF, PARTNER, CUSTOM 等
+	CustomRelation string    `json:"custom_relation"`
 	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ProfitSharingOrder 分账单 (含解冻剩余资金的请求)
+type ProfitSharingOrder struct {
+	ID              uint                  `gorm:"primaryKey" json:"id"`
+	OrderID         string                `gorm:"uniqueIndex;not null" json:"order_id"`                         // 微信分账单号
+	OutOrderNo      string                `gorm:"uniqueIndex:idx_ps_out_order_no;not null" json:"out_order_no"` // 商户分账单号 (商户内唯一)
+	TransactionID   string                `gorm:"index;not null" json:"transaction_id"`
+	MchID           string                `gorm:"index;uniqueIndex:idx_ps_out_order_no" json:"mchid"`
+	SpMchID         string                `gorm:"index" json:"sp_mchid"`
+	State           string                `json:"state"` // PROCESSING, FINISHED
+	UnfreezeUnsplit bool                  `json:"unfreeze_unsplit"`
+	Receivers       []ProfitSharingDetail `gorm:"foreignKey:ProfitSharingOrderID" json:"receivers"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+}
+
+// ProfitSharingDetail 分账明细，每个接收方一条 (解冻给分账方时类型为 MERCHANT_ID、账号为分账方自身)
+type ProfitSharingDetail struct {
+	ID                   uint       `gorm:"primaryKey" json:"id"`
+	ProfitSharingOrderID uint       `gorm:"index" json:"-"`
+	DetailID             string     `gorm:"uniqueIndex;not null" json:"detail_id"`
+	Type                 string     `json:"type"`
+	Account              string     `json:"account"`
+	Amount               int64      `json:"amount"`
+	Description          string     `json:"description"`
+	Result               string     `json:"result"`      // PENDING, SUCCESS, CLOSED
+	FailReason           string     `json:"fail_reason"` // 分账失败原因，如 RECEIVER_INVALID
+	CallbackStatus       string     `json:"callback_status"`
+	FinishedAt           *time.Time `json:"finish_time"`
+	CreatedAt            time.Time  `json:"create_time"`
+}
+
+// ProfitSharingReturn 分账回退单
+type ProfitSharingReturn struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ReturnID       string     `gorm:"uniqueIndex;not null" json:"return_id"`                          // 微信回退单号
+	OutReturnNo    string     `gorm:"uniqueIndex:idx_ps_out_return_no;not null" json:"out_return_no"` // 商户回退单号 (商户内唯一)
+	OrderID        string     `gorm:"index;not null" json:"order_id"`                                 // 原分账单号
+	OutOrderNo     string     `json:"out_order_no"`
+	MchID          string     `gorm:"index;uniqueIndex:idx_ps_out_return_no" json:"mchid"`
+	SpMchID        string     `gorm:"index" json:"sp_mchid"`
+	ReturnMchID    string     `json:"return_mchid"` // 回退商户号 (原分账接收方)
+	Amount         int64      `json:"amount"`
+	Description    string     `json:"description"`
+	Result         string     `json:"result"` // PROCESSING, SUCCESS, FAILED
+	CallbackStatus string     `json:"callback_status"`
+	FailReason     string     `json:"fail_reason"`
+	FinishedAt     *time.Time `json:"finish_time"`
+	CreatedAt      time.Time  `json:"create_time"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TransferBatch 商家转账到零钱批次单
+type TransferBatch struct {
+	ID              uint             `gorm:"primaryKey" json:"id"`
+	BatchID         string           `gorm:"uniqueIndex;not null" json:"batch_id"`                   // 微信批次单号
+	OutBatchNo      string           `gorm:"uniqueIndex:idx_out_batch;not null" json:"out_batch_no"` // 商家批次单号 (商户内唯一)
+	MchID           string           `gorm:"uniqueIndex:idx_out_batch;not null" json:"mchid"`
+	AppID           string           `json:"appid"`
+	BatchName       string           `json:"batch_name"`
+	BatchRemark     string           `json:"batch_remark"`
+	TransferSceneID string           `json:"transfer_scene_id"`
+	NotifyUrl       string           `json:"notify_url"`
+	TotalAmount     int64            `json:"total_amount"`
+	TotalNum        int              `json:"total_num"`
+	BatchStatus     string           `json:"batch_status"` // ACCEPTED, PROCESSING, FINISHED
+	SuccessAmount   int64            `json:"success_amount"`
+	SuccessNum      int              `json:"success_num"`
+	FailAmount      int64            `json:"fail_amount"`
+	FailNum         int              `json:"fail_num"`
+	CallbackStatus  string           `json:"callback_status"`
+	Details         []TransferDetail `gorm:"foreignKey:TransferBatchID" json:"transfer_detail_list"`
+	CreatedAt       time.Time        `json:"create_time"`
+	UpdatedAt       time.Time        `json:"update_time"`
+}
+
+// TransferDetail 转账明细单，每个收款用户一条
+type TransferDetail struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	TransferBatchID uint      `gorm:"index" json:"-"`
+	DetailID        string    `gorm:"uniqueIndex;not null" json:"detail_id"` // 微信明细单号
+	OutDetailNo     string    `gorm:"index;not null" json:"out_detail_no"`   // 商家明细单号 (商户内唯一)
+	TransferAmount  int64     `json:"transfer_amount"`
+	TransferRemark  string    `json:"transfer_remark"`
+	OpenID          string    `json:"openid"`
+	UserName        string    `json:"user_name"`     // 收款用户姓名 (解密后)
+	DetailStatus    string    `json:"detail_status"` // PROCESSING, SUCCESS, FAIL
+	FailReason      string    `json:"fail_reason"`
+	CreatedAt       time.Time `json:"initiate_time"`
+	UpdatedAt       time.Time `json:"update_time"`
 }
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"gorm.io/gorm"
+)
+
+// billDownloadTTL 账单下载链接有效期
+const billDownloadTTL = 30 * time.Second
+
+// billFeeRate 沙箱统一手续费费率 (0.6%)
+const billFeeRate = "0.60%"
+
+// billDownloads 待下载的账单文件，key 为下载链接中的 token
+var billDownloads sync.Map
+
+// billFile 账单文件内容及过期时间
+type billFile struct {
+	content   []byte
+	expiresAt time.Time
+}
+
+// 交易账单各类型的字段
+var (
+	tradeBillBaseColumns = []string{"交易时间", "公众账号ID", "商户号", "特约商户号", "设备号", "微信订单号", "商户订单号", "用户标识", "交易类型", "交易状态", "付款银行", "货币种类", "应结订单金额", "代金券金额"}
+	tradeBillColumns     = map[string][]string{
+		"ALL":     append(append([]string{}, tradeBillBaseColumns...), "微信退款单号", "商户退款单号", "退款金额", "充值券退款金额", "退款类型", "退款状态", "商品名称", "商户数据包", "手续费", "费率", "订单金额", "申请退款金额", "费率备注"),
+		"SUCCESS": append(append([]string{}, tradeBillBaseColumns...), "商品名称", "商户数据包", "手续费", "费率", "订单金额", "费率备注"),
+		"REFUND":  append(append([]string{}, tradeBillBaseColumns...), "退款申请时间", "退款成功时间", "微信退款单号", "商户退款单号", "退款金额", "充值券退款金额", "退款类型", "退款状态", "商品名称", "商户数据包", "手续费", "费率", "订单金额", "申请退款金额", "费率备注"),
+	}
+	tradeBillSummaryColumns = []string{"总交易单数", "应结订单总金额", "退款总金额", "充值券退款总金额", "手续费总金额", "订单总金额", "申请退款总金额"}
+	fundFlowBillColumns     = []string{"记账时间", "微信支付业务单号", "资金流水单号", "业务名称", "业务类型", "收支类型", "收支金额（元）", "账户结余（元）", "资金变更提交申请人", "备注", "业务凭证号"}
+	fundFlowSummaryColumns  = []string{"资金流水总笔数", "收入笔数", "收入金额", "支出笔数", "支出金额"}
+)
+
+// tradeBillRecord 交易账单中的一行：支付成功记录或退款成功记录
+type tradeBillRecord struct {
+	time   time.Time
+	tx     model.Transaction
+	refund *model.Refund
+}
+
+// fundFlowEntry 资金账单中的一笔资金流水
+type fundFlowEntry struct {
+	time       time.Time
+	businessNo string
+	flowNo     string
+	name       string
+	income     bool
+	amount     int64
+	voucherNo  string
+}
+
+// parseBillDate 解析账单日期，返回当天的起止时间
+func parseBillDate(billDate string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", billDate, time.Local)
+	if err != nil {
+		return start, start, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "bill_date格式不正确，应为YYYY-MM-DD")
+	}
+	if start.After(time.Now()) {
+		return start, start, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "账单日期不能晚于当前日期")
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// TradeBill 生成交易账单：bill_date 当天支付成功的订单 (SUCCESS) 及退款成功的退款 (REFUND)
+// 服务商商户号下载时包含其特约商户的交易，传入 subMchID 时仅包含该特约商户
+func TradeBill(mchid, subMchID, billDate, billType string) ([]byte, error) {
+	if billType == "" {
+		billType = "ALL"
+	}
+	columns, ok := tradeBillColumns[billType]
+	if !ok {
+		return nil, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "bill_type只能为ALL、SUCCESS或REFUND")
+	}
+	start, end, err := parseBillDate(billDate)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := func() *gorm.DB {
+		if subMchID != "" {
+			return core.DB.Where("sp_mch_id = ? AND mch_id = ?", mchid, subMchID)
+		}
+		// 旧版本数据的 sp_mch_id 可能为 NULL
+		return core.DB.Where("(mch_id = ? AND (sp_mch_id = '' OR sp_mch_id IS NULL)) OR sp_mch_id = ?", mchid, mchid)
+	}
+
+	var records []tradeBillRecord
+	if billType != "REFUND" {
+		var txs []model.Transaction
+		scope().Where("status IN ?", []string{tradestate.Success, tradestate.Refund}).Find(&txs)
+		for _, tx := range txs {
+			paidAt := tx.UpdatedAt
+			if tx.PaidAt != nil {
+				paidAt = *tx.PaidAt
+			}
+			if !paidAt.Before(start) && paidAt.Before(end) {
+				records = append(records, tradeBillRecord{time: paidAt, tx: tx})
+			}
+		}
+	}
+	if billType != "SUCCESS" {
+		var refunds []model.Refund
+		scope().Where("status = ?", "SUCCESS").Find(&refunds)
+		for i := range refunds {
+			successAt := refunds[i].UpdatedAt
+			if refunds[i].SuccessAt != nil {
+				successAt = *refunds[i].SuccessAt
+			}
+			if successAt.Before(start) || !successAt.Before(end) {
+				continue
+			}
+			var tx model.Transaction
+			core.DB.Where("transaction_id = ?", refunds[i].TransactionID).First(&tx)
+			records = append(records, tradeBillRecord{time: successAt, tx: tx, refund: &refunds[i]})
+		}
+	}
+	if len(records) == 0 {
+		return nil, NewBizError(http.StatusBadRequest, "NO_STATEMENT_EXIST", "账单文件不存在")
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].time.Before(records[j].time) })
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(columns, ",") + "\r\n")
+
+	var settlementTotal, refundTotal, feeTotal, orderTotal, refundApplyTotal int64
+	for _, r := range records {
+		values := tradeBillValues(r)
+		fields := make([]string, len(columns))
+		for i, col := range columns {
+			fields[i] = values[col]
+		}
+		buf.WriteString(billLine(fields...))
+
+		if r.refund == nil {
+			settlementTotal += r.tx.Amount
+			orderTotal += r.tx.Amount
+			feeTotal += billFee(r.tx.Amount)
+		} else {
+			refundTotal += r.refund.Amount
+			refundApplyTotal += r.refund.Amount
+			feeTotal -= billFee(r.refund.Amount)
+		}
+	}
+
+	buf.WriteString(strings.Join(tradeBillSummaryColumns, ",") + "\r\n")
+	buf.WriteString(billLine(
+		fmt.Sprint(len(records)),
+		billYuan(settlementTotal),
+		billYuan(refundTotal),
+		billYuan(0),
+		billFeeYuan(feeTotal),
+		billYuan(orderTotal),
+		billYuan(refundApplyTotal),
+	))
+	return buf.Bytes(), nil
+}
+
+// tradeBillValues 交易账单一行中各字段的值，按字段名索引
+func tradeBillValues(r tradeBillRecord) map[string]string {
+	tx := r.tx
+	appid, mchid, subMchID := tx.AppID, tx.MchID, "0"
+	if tx.SpMchID != "" {
+		appid, mchid, subMchID = tx.SpAppID, tx.SpMchID, tx.MchID
+	}
+	currency := tx.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+
+	values := map[string]string{
+		"交易时间":    r.time.Format("2006-01-02 15:04:05"),
+		"公众账号ID":  appid,
+		"商户号":     mchid,
+		"特约商户号":   subMchID,
+		"设备号":     "",
+		"微信订单号":   tx.TransactionID,
+		"商户订单号":   tx.OutTradeNo,
+		"用户标识":    tx.PayerOpenID,
+		"交易类型":    tx.TradeType,
+		"交易状态":    "SUCCESS",
+		"付款银行":    "OTHERS",
+		"货币种类":    currency,
+		"应结订单金额":  billYuan(tx.Amount),
+		"代金券金额":   billYuan(0),
+		"退款申请时间":  "",
+		"退款成功时间":  "",
+		"微信退款单号":  "0",
+		"商户退款单号":  "0",
+		"退款金额":    billYuan(0),
+		"充值券退款金额": billYuan(0),
+		"退款类型":    "",
+		"退款状态":    "",
+		"商品名称":    tx.Description,
+		"商户数据包":   "",
+		"手续费":     billFeeYuan(billFee(tx.Amount)),
+		"费率":      billFeeRate,
+		"订单金额":    billYuan(tx.Amount),
+		"申请退款金额":  billYuan(0),
+		"费率备注":    "",
+	}
+
+	if refund := r.refund; refund != nil {
+		values["交易状态"] = "REFUND"
+		values["应结订单金额"] = billYuan(0)
+		values["订单金额"] = billYuan(0)
+		values["退款申请时间"] = refund.CreatedAt.Format("2006-01-02 15:04:05")
+		values["退款成功时间"] = r.time.Format("2006-01-02 15:04:05")
+		values["微信退款单号"] = refund.RefundID
+		values["商户退款单号"] = refund.OutRefundNo
+		values["退款金额"] = billYuan(refund.Amount)
+		values["退款类型"] = "ORIGINAL"
+		values["退款状态"] = "SUCCESS"
+		values["手续费"] = billFeeYuan(-billFee(refund.Amount))
+		values["申请退款金额"] = billYuan(refund.Amount)
+	}
+	return values
+}
+
+// FundFlowBill 生成资金账单：基本账户中支付收入、退款支出及手续费的资金流水，账户结余从首笔流水起累计
+func FundFlowBill(mchid, billDate, accountType string) ([]byte, error) {
+	switch accountType {
+	case "", "BASIC", "OPERATION", "FEES":
+	default:
+		return nil, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "account_type只能为BASIC、OPERATION或FEES")
+	}
+	start, end, err := parseBillDate(billDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// 沙箱中运营账户及手续费账户不产生资金流水
+	var entries []fundFlowEntry
+	if accountType == "" || accountType == "BASIC" {
+		entries = basicAccountEntries(mchid, end)
+	}
+
+	var balance int64
+	var dayEntries []fundFlowEntry
+	var balances []int64
+	for _, e := range entries {
+		if e.income {
+			balance += e.amount
+		} else {
+			balance -= e.amount
+		}
+		if !e.time.Before(start) {
+			dayEntries = append(dayEntries, e)
+			balances = append(balances, balance)
+		}
+	}
+	if len(dayEntries) == 0 {
+		return nil, NewBizError(http.StatusBadRequest, "NO_STATEMENT_EXIST", "账单文件不存在")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(fundFlowBillColumns, ",") + "\r\n")
+
+	var incomeNum, expenseNum int
+	var incomeTotal, expenseTotal int64
+	for i, e := range dayEntries {
+		direction := "支出"
+		if e.income {
+			direction = "收入"
+			incomeNum++
+			incomeTotal += e.amount
+		} else {
+			expenseNum++
+			expenseTotal += e.amount
+		}
+		buf.WriteString(billLine(
+			e.time.Format("2006-01-02 15:04:05"),
+			e.businessNo,
+			e.flowNo,
+			e.name,
+			e.name,
+			direction,
+			billYuan(e.amount),
+			billYuan(balances[i]),
+			"system",
+			"",
+			e.voucherNo,
+		))
+	}
+
+	buf.WriteString(strings.Join(fundFlowSummaryColumns, ",") + "\r\n")
+	buf.WriteString(billLine(
+		fmt.Sprint(len(dayEntries)),
+		fmt.Sprint(incomeNum),
+		billYuan(incomeTotal),
+		fmt.Sprint(expenseNum),
+		billYuan(expenseTotal),
+	))
+	return buf.Bytes(), nil
+}
+
+// basicAccountEntries 商户基本账户截至 end 的全部资金流水 (按记账时间排序)
+// 支付成功记收入并扣除手续费，退款成功记支出并退还手续费
+func basicAccountEntries(mchid string, end time.Time) []fundFlowEntry {
+	var entries []fundFlowEntry
+
+	var txs []model.Transaction
+	core.DB.Where("mch_id = ? AND status IN ?", mchid, []string{tradestate.Success, tradestate.Refund}).Find(&txs)
+	for _, tx := range txs {
+		paidAt := tx.UpdatedAt
+		if tx.PaidAt != nil {
+			paidAt = *tx.PaidAt
+		}
+		if !paidAt.Before(end) {
+			continue
+		}
+		entries = append(entries, fundFlowEntry{time: paidAt, businessNo: tx.TransactionID, flowNo: tx.TransactionID + "01", name: "交易", income: true, amount: tx.Amount, voucherNo: tx.OutTradeNo})
+		if fee := billFeeFen(tx.Amount); fee > 0 {
+			entries = append(entries, fundFlowEntry{time: paidAt, businessNo: tx.TransactionID, flowNo: tx.TransactionID + "02", name: "扣除交易手续费", amount: fee, voucherNo: tx.OutTradeNo})
+		}
+	}
+
+	var refunds []model.Refund
+	core.DB.Where("mch_id = ? AND status = ?", mchid, "SUCCESS").Find(&refunds)
+	for _, refund := range refunds {
+		successAt := refund.UpdatedAt
+		if refund.SuccessAt != nil {
+			successAt = *refund.SuccessAt
+		}
+		if !successAt.Before(end) {
+			continue
+		}
+		entries = append(entries, fundFlowEntry{time: successAt, businessNo: refund.RefundID, flowNo: refund.RefundID + "01", name: "退款", amount: refund.Amount, voucherNo: refund.OutRefundNo})
+		if fee := billFeeFen(refund.Amount); fee > 0 {
+			entries = append(entries, fundFlowEntry{time: successAt, businessNo: refund.RefundID, flowNo: refund.RefundID + "02", name: "退还交易手续费", income: true, amount: fee, voucherNo: refund.OutRefundNo})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].time.Before(entries[j].time) })
+	return entries
+}
+
+// billLine 账单数据行：每个字段以反引号开头，逗号分隔
+func billLine(fields ...string) string {
+	return "`" + strings.Join(fields, ",`") + "\r\n"
+}
+
+// billYuan 金额 (分) 格式化为元，保留两位小数
+func billYuan(fen int64) string {
+	sign := ""
+	if fen < 0 {
+		sign, fen = "-", -fen
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, fen/100, fen%100)
+}
+
+// billFee 按 0.6% 费率计算手续费，单位为 0.00001 元 (1 分 = 1000 单位)
+func billFee(fen int64) int64 {
+	return fen * 6
+}
+
+// billFeeFen 手续费四舍五入到分，用于资金流水
+func billFeeFen(fen int64) int64 {
+	return (billFee(fen) + 500) / 1000
+}
+
+// billFeeYuan 手续费格式化为元，保留五位小数
+func billFeeYuan(fee int64) string {
+	sign := ""
+	if fee < 0 {
+		sign, fee = "-", -fee
+	}
+	return fmt.Sprintf("%s%d.%05d", sign, fee/100000, fee%100000)
+}
+
+// SaveBillDownload 保存账单文件供下载，tarType 为 GZIP 时压缩；返回下载 token 及原始账单的 SHA1 摘要
+func SaveBillDownload(content []byte, tarType string) (string, string, error) {
+	sum := sha1.Sum(content)
+	hashValue := hex.EncodeToString(sum[:])
+
+	switch tarType {
+	case "":
+	case "GZIP":
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(content); err != nil {
+			return "", "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", "", err
+		}
+		content = buf.Bytes()
+	default:
+		return "", "", NewBizError(http.StatusBadRequest, "PARAM_ERROR", "tar_type只能为GZIP")
+	}
+
+	// 清理已过期的账单文件
+	now := time.Now()
+	billDownloads.Range(func(key, value interface{}) bool {
+		if now.After(value.(billFile).expiresAt) {
+			billDownloads.Delete(key)
+		}
+		return true
+	})
+
+	token := core.RandomString(32)
+	billDownloads.Store(token, billFile{content: content, expiresAt: now.Add(billDownloadTTL)})
+	return token, hashValue, nil
+}
+
+// BillDownload 按 token 获取待下载的账单文件，链接过期或不存在时返回 false
+func BillDownload(token string) ([]byte, bool) {
+	value, ok := billDownloads.Load(token)
+	if !ok {
+		return nil, false
+	}
+	file := value.(billFile)
+	if time.Now().After(file.expiresAt) {
+		billDownloads.Delete(token)
+		return nil, false
+	}
+	return file.content, true
+}
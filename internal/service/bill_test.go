@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestBillYuan(t *testing.T) {
+	tests := []struct {
+		fen  int64
+		want string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{10, "0.10"},
+		{100, "1.00"},
+		{12345, "123.45"},
+		{-1, "-0.01"},
+		{-12345, "-123.45"},
+	}
+	for _, tt := range tests {
+		if got := billYuan(tt.fen); got != tt.want {
+			t.Errorf("billYuan(%d) = %s, want %s", tt.fen, got, tt.want)
+		}
+	}
+}
+
+func TestBillFee(t *testing.T) {
+	tests := []struct {
+		fen     int64
+		fee     int64
+		feeFen  int64
+		feeYuan string
+	}{
+		{0, 0, 0, "0.00000"},
+		{1, 6, 0, "0.00006"},
+		{83, 498, 0, "0.00498"}, // 不足半分舍去
+		{84, 504, 1, "0.00504"}, // 满半分进位
+		{100, 600, 1, "0.00600"},
+		{10000, 60000, 60, "0.60000"},
+		{123456, 740736, 741, "7.40736"},
+		{-100, -600, 0, "-0.00600"}, // 退款手续费为负
+	}
+	for _, tt := range tests {
+		if got := billFee(tt.fen); got != tt.fee {
+			t.Errorf("billFee(%d) = %d, want %d", tt.fen, got, tt.fee)
+		}
+		if got := billFeeFen(tt.fen); got != tt.feeFen {
+			t.Errorf("billFeeFen(%d) = %d, want %d", tt.fen, got, tt.feeFen)
+		}
+		if got := billFeeYuan(billFee(tt.fen)); got != tt.feeYuan {
+			t.Errorf("billFeeYuan(billFee(%d)) = %s, want %s", tt.fen, got, tt.feeYuan)
+		}
+	}
+}
+
+func TestBillLine(t *testing.T) {
+	if got, want := billLine("2026-01-02 03:04:05", "wx1", "1.00"), "`2026-01-02 03:04:05,`wx1,`1.00\r\n"; got != want {
+		t.Errorf("billLine = %q, want %q", got, want)
+	}
+}
+
+// parsedBill 按行拆分的账单：表头、数据行、汇总表头、汇总行
+type parsedBill struct {
+	header, summaryHeader []string
+	rows                  [][]string
+	summary               []string
+}
+
+func parseBill(t *testing.T, content []byte) parsedBill {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(string(content), "\r\n"), "\r\n")
+	if len(lines) < 3 {
+		t.Fatalf("bill has %d lines: %q", len(lines), content)
+	}
+	fields := func(line string) []string {
+		if !strings.HasPrefix(line, "`") {
+			t.Fatalf("data line %q does not start with a backquote", line)
+		}
+		return strings.Split(strings.TrimPrefix(line, "`"), ",`")
+	}
+	bill := parsedBill{
+		header:        strings.Split(lines[0], ","),
+		summaryHeader: strings.Split(lines[len(lines)-2], ","),
+		summary:       fields(lines[len(lines)-1]),
+	}
+	for _, line := range lines[1 : len(lines)-2] {
+		bill.rows = append(bill.rows, fields(line))
+	}
+	return bill
+}
+
+// column 返回数据行中指定字段的值
+func (b parsedBill) column(row int, name string) string {
+	for i, col := range b.header {
+		if col == name {
+			return b.rows[row][i]
+		}
+	}
+	return ""
+}
+
+// setupBillData 账单日 2024-03-01：商户 100 两笔支付、一笔退款，前一日一笔支付；服务商 300 下特约商户 400 一笔支付
+func setupBillData(t *testing.T) {
+	t.Helper()
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	at := func(day, hour int) *time.Time {
+		ts := time.Date(2024, 3, day, hour, 0, 0, 0, time.Local)
+		return &ts
+	}
+	core.DB.Create(&model.Transaction{MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000001", Amount: 10000, TradeType: model.TradeTypeJSAPI, Status: "SUCCESS", PaidAt: at(1, 10)})
+	core.DB.Create(&model.Transaction{MchID: "100", OutTradeNo: "ORDER_2", TransactionID: "4200000002", Amount: 5000, TradeType: model.TradeTypeNative, Status: "REFUND", PaidAt: at(1, 11)})
+	core.DB.Create(&model.Transaction{MchID: "100", OutTradeNo: "ORDER_3", TransactionID: "4200000003", Amount: 1000, Status: "SUCCESS", PaidAt: at(0, 9)})
+	core.DB.Create(&model.Transaction{MchID: "100", OutTradeNo: "ORDER_4", TransactionID: "4200000004", Amount: 700, Status: "NOTPAY"})
+	core.DB.Create(&model.Transaction{SpMchID: "300", MchID: "400", OutTradeNo: "ORDER_5", TransactionID: "4200000005", Amount: 3000, Status: "SUCCESS", PaidAt: at(1, 13)})
+	core.DB.Create(&model.Refund{RefundID: "5030000001", OutRefundNo: "REFUND_1", TransactionID: "4200000002", MchID: "100", Amount: 2000, Total: 5000, Status: "SUCCESS", SuccessAt: at(1, 12)})
+}
+
+func TestTradeBill(t *testing.T) {
+	setupBillData(t)
+
+	content, err := TradeBill("100", "", "2024-03-01", "ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill := parseBill(t, content)
+	if got, want := strings.Join(bill.header, ","), strings.Join(tradeBillColumns["ALL"], ","); got != want {
+		t.Errorf("header = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(bill.summaryHeader, ","), strings.Join(tradeBillSummaryColumns, ","); got != want {
+		t.Errorf("summary header = %s, want %s", got, want)
+	}
+	if len(bill.rows) != 3 {
+		t.Fatalf("rows = %d, want 3", len(bill.rows))
+	}
+	for i, row := range bill.rows {
+		if len(row) != len(bill.header) {
+			t.Errorf("row %d has %d fields, want %d", i, len(row), len(bill.header))
+		}
+	}
+
+	// 按时间排序：两笔支付后为退款
+	rows := []struct {
+		outTradeNo, state, settlement, refundID, refundAmount, fee string
+	}{
+		{"ORDER_1", "SUCCESS", "100.00", "0", "0.00", "0.60000"},
+		{"ORDER_2", "SUCCESS", "50.00", "0", "0.00", "0.30000"},
+		{"ORDER_2", "REFUND", "0.00", "5030000001", "20.00", "-0.12000"},
+	}
+	for i, want := range rows {
+		got := []string{bill.column(i, "商户订单号"), bill.column(i, "交易状态"), bill.column(i, "应结订单金额"),
+			bill.column(i, "微信退款单号"), bill.column(i, "退款金额"), bill.column(i, "手续费")}
+		if strings.Join(got, ",") != strings.Join([]string{want.outTradeNo, want.state, want.settlement, want.refundID, want.refundAmount, want.fee}, ",") {
+			t.Errorf("row %d = %v, want %+v", i, got, want)
+		}
+	}
+	if got, want := strings.Join(bill.summary, ","), "3,150.00,20.00,0.00,0.78000,150.00,20.00"; got != want {
+		t.Errorf("summary = %s, want %s", got, want)
+	}
+
+	// 服务商账单包含特约商户的交易
+	content, err = TradeBill("300", "400", "2024-03-01", "SUCCESS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill = parseBill(t, content)
+	if len(bill.rows) != 1 || bill.column(0, "商户号") != "300" || bill.column(0, "特约商户号") != "400" {
+		t.Errorf("partner bill rows = %v", bill.rows)
+	}
+	if len(bill.header) != len(tradeBillColumns["SUCCESS"]) {
+		t.Errorf("SUCCESS header has %d columns, want %d", len(bill.header), len(tradeBillColumns["SUCCESS"]))
+	}
+
+	if _, err := TradeBill("100", "", "2024-03-02", "ALL"); err == nil {
+		t.Error("empty day: want NO_STATEMENT_EXIST")
+	} else if status, code, _ := ErrorDetail(err); status != http.StatusBadRequest || code != "NO_STATEMENT_EXIST" {
+		t.Errorf("empty day: err = %d %s", status, code)
+	}
+}
+
+func TestFundFlowBill(t *testing.T) {
+	setupBillData(t)
+
+	content, err := FundFlowBill("100", "2024-03-01", "BASIC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill := parseBill(t, content)
+	if got, want := strings.Join(bill.header, ","), strings.Join(fundFlowBillColumns, ","); got != want {
+		t.Errorf("header = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(bill.summaryHeader, ","), strings.Join(fundFlowSummaryColumns, ","); got != want {
+		t.Errorf("summary header = %s, want %s", got, want)
+	}
+
+	// 账户结余包含前一日的收入 (10.00 - 0.06)
+	rows := []struct{ name, direction, amount, balance string }{
+		{"交易", "收入", "100.00", "109.94"},
+		{"扣除交易手续费", "支出", "0.60", "109.34"},
+		{"交易", "收入", "50.00", "159.34"},
+		{"扣除交易手续费", "支出", "0.30", "159.04"},
+		{"退款", "支出", "20.00", "139.04"},
+		{"退还交易手续费", "收入", "0.12", "139.16"},
+	}
+	if len(bill.rows) != len(rows) {
+		t.Fatalf("rows = %d, want %d", len(bill.rows), len(rows))
+	}
+	for i, want := range rows {
+		got := struct{ name, direction, amount, balance string }{
+			bill.column(i, "业务名称"), bill.column(i, "收支类型"), bill.column(i, "收支金额（元）"), bill.column(i, "账户结余（元）"),
+		}
+		if got != want {
+			t.Errorf("row %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if got, want := strings.Join(bill.summary, ","), "6,3,150.12,3,20.90"; got != want {
+		t.Errorf("summary = %s, want %s", got, want)
+	}
+
+	if _, err := FundFlowBill("100", "2024-03-01", "OPERATION"); err == nil {
+		t.Error("OPERATION account: want NO_STATEMENT_EXIST")
+	}
+}
+
+func TestSaveBillDownload(t *testing.T) {
+	content := []byte("交易时间,公众账号ID\r\n`2024-03-01 10:00:00,`wx1\r\n")
+	sum := sha1.Sum(content)
+	wantHash := hex.EncodeToString(sum[:])
+
+	for _, tarType := range []string{"", "GZIP"} {
+		token, hashValue, err := SaveBillDownload(content, tarType)
+		if err != nil {
+			t.Fatalf("%q: %v", tarType, err)
+		}
+		if hashValue != wantHash {
+			t.Errorf("%q: hash_value = %s, want %s", tarType, hashValue, wantHash)
+		}
+		file, ok := BillDownload(token)
+		if !ok {
+			t.Fatalf("%q: download not found", tarType)
+		}
+		if tarType == "GZIP" {
+			r, err := gzip.NewReader(bytes.NewReader(file))
+			if err != nil {
+				t.Fatalf("gzip: %v", err)
+			}
+			if file, err = io.ReadAll(r); err != nil {
+				t.Fatalf("gunzip: %v", err)
+			}
+		}
+		if !bytes.Equal(file, content) {
+			t.Errorf("%q: downloaded %q, want %q", tarType, file, content)
+		}
+	}
+
+	if _, ok := BillDownload("unknown"); ok {
+		t.Error("unknown token: want not found")
+	}
+	if _, _, err := SaveBillDownload(content, "ZIP"); err == nil {
+		t.Error("ZIP: want PARAM_ERROR")
+	} else if _, code, _ := ErrorDetail(err); code != "PARAM_ERROR" {
+		t.Errorf("ZIP: code = %s, want PARAM_ERROR", code)
+	}
+}
+
+func TestTradeBillNullSpMchID(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	paidAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local)
+	refundAt := paidAt.Add(time.Hour)
+	tx := model.Transaction{MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000001", Amount: 10000, Status: "REFUND", PaidAt: &paidAt}
+	refund := model.Refund{RefundID: "5030000001", OutRefundNo: "REFUND_1", TransactionID: "4200000001", MchID: "100", Amount: 2000, Status: "SUCCESS", SuccessAt: &refundAt}
+	core.DB.Create(&tx)
+	core.DB.Create(&refund)
+	// 旧版本数据库中普通商户记录的 sp_mch_id 为 NULL
+	core.DB.Model(&tx).Update("sp_mch_id", gorm.Expr("NULL"))
+	core.DB.Model(&refund).Update("sp_mch_id", gorm.Expr("NULL"))
+
+	content, err := TradeBill("100", "", "2024-03-01", "ALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill := parseBill(t, content)
+	if len(bill.rows) != 2 || bill.column(0, "商户订单号") != "ORDER_1" || bill.column(1, "商户退款单号") != "REFUND_1" {
+		t.Errorf("rows = %v, want the payment and its refund", bill.rows)
+	}
+}
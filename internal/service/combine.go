@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+	"wepay-sandbox/internal/worker"
+
+	"gorm.io/gorm"
+)
+
+// PayCombineOrder 合单支付：在同一事务内将合单及其全部子单置为支付成功，并发送合单通知
+// 任一子单不可支付时整单失败，不会出现部分子单支付成功的情况
+func PayCombineOrder(combineID uint) (model.CombineOrder, error) {
+	var order model.CombineOrder
+	if err := core.DB.Preload("SubOrders").First(&order, combineID).Error; err != nil {
+		return order, NewBizError(http.StatusNotFound, "RESOURCE_NOT_EXISTS", "合单不存在")
+	}
+
+	if order.Status == tradestate.Success {
+		return order, nil
+	}
+	if err := CloseExpiredCombineOrder(order); err != nil {
+		return order, err
+	}
+	if order.Status != tradestate.NotPay {
+		return order, NewBizError(http.StatusBadRequest, "ORDER_CLOSED", "合单已关闭")
+	}
+	for _, sub := range order.SubOrders {
+		if !tradestate.CanTransit(sub.Status, tradestate.Success) {
+			return order, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "子单 "+sub.OutTradeNo+" 状态为 "+sub.Status+"，无法支付")
+		}
+	}
+
+	now := time.Now()
+	// 按状态条件更新，并发关单 (含过期关闭) 时整单回滚
+	errChanged := NewBizError(http.StatusBadRequest, "ORDER_CLOSED", "合单状态已变更，无法支付")
+	err := core.DB.Transaction(func(db *gorm.DB) error {
+		result := db.Model(&model.Transaction{}).Where("combine_id = ? AND status IN ?", order.ID, tradestate.Sources(tradestate.Success)).
+			Updates(map[string]interface{}{"status": tradestate.Success, "paid_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(order.SubOrders)) {
+			return errChanged
+		}
+
+		result = db.Model(&model.CombineOrder{}).Where("id = ? AND status = ?", order.ID, tradestate.NotPay).
+			Updates(map[string]interface{}{"status": tradestate.Success, "paid_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errChanged
+		}
+		return nil
+	})
+	if err != nil {
+		return order, err
+	}
+
+	core.DB.Preload("SubOrders").First(&order, order.ID)
+	worker.TriggerCombineCallback(order)
+	return order, nil
+}
+
+// FindByPrepayID 按预支付ID查询待支付订单：合单返回其全部子单，否则返回对应的单笔订单
+// 合单子单不保存预支付ID，需先按合单的预支付ID解析
+func FindByPrepayID(prepayID string) ([]model.Transaction, error) {
+	var order model.CombineOrder
+	if core.DB.Preload("SubOrders", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("prepay_id = ?", prepayID).First(&order).Error == nil && len(order.SubOrders) > 0 {
+		return order.SubOrders, nil
+	}
+
+	var tx model.Transaction
+	if err := core.DB.Where("prepay_id = ?", prepayID).First(&tx).Error; err != nil {
+		return nil, err
+	}
+	return []model.Transaction{tx}, nil
+}
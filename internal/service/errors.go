@@ -0,0 +1,27 @@
+package service
+
+import "net/http"
+
+// BizError 业务错误，Code/Message 与微信支付 V3 错误码保持一致
+type BizError struct {
+	Status  int    // HTTP 状态码
+	Code    string // 错误码，如 NOT_ENOUGH
+	Message string // 错误描述
+}
+
+func (e *BizError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewBizError 创建业务错误
+func NewBizError(status int, code, message string) *BizError {
+	return &BizError{Status: status, Code: code, Message: message}
+}
+
+// ErrorDetail 获取错误对应的 HTTP 状态码、错误码及描述，非业务错误视为 SYSTEM_ERROR
+func ErrorDetail(err error) (int, string, string) {
+	if e, ok := err.(*BizError); ok {
+		return e.Status, e.Code, e.Message
+	}
+	return http.StatusInternalServerError, "SYSTEM_ERROR", err.Error()
+}
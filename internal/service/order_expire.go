@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"gorm.io/gorm"
+)
+
+// orderExpireInterval 过期订单扫描间隔
+const orderExpireInterval = 5 * time.Second
+
+// ErrOrderExpired 订单已超过支付有效期
+var ErrOrderExpired = NewBizError(http.StatusBadRequest, "ORDER_CLOSED", "订单已超过支付有效期 (time_expire)，已关闭")
+
+// StartOrderExpiry 启动后台任务，定时关闭超过 time_expire 仍未支付的订单 (含合单)
+func StartOrderExpiry() {
+	go func() {
+		CloseExpiredOrders()
+		for range time.Tick(orderExpireInterval) {
+			CloseExpiredOrders()
+		}
+	}()
+}
+
+// CloseExpiredOrders 关闭已过期的未支付订单，合单及其子单一起关闭
+func CloseExpiredOrders() {
+	now := time.Now()
+
+	result := core.DB.Model(&model.Transaction{}).
+		Where("status IN ? AND combine_id = 0 AND time_expire IS NOT NULL AND time_expire <= ?", tradestate.Sources(tradestate.Closed), now).
+		Update("status", tradestate.Closed)
+	if result.Error != nil {
+		fmt.Printf("Close expired orders failed: %v\n", result.Error)
+	}
+
+	var orders []model.CombineOrder
+	core.DB.Where("status = ? AND time_expire IS NOT NULL AND time_expire <= ?", tradestate.NotPay, now).Find(&orders)
+	for _, order := range orders {
+		if err := CloseCombineOrder(order.ID); err != nil {
+			fmt.Printf("Close expired combine order %s failed: %v\n", order.CombineOutTradeNo, err)
+		}
+	}
+}
+
+// IsOrderExpired 未支付 (可关闭) 订单是否已超过 time_expire
+func IsOrderExpired(status string, timeExpire *time.Time) bool {
+	return tradestate.CanTransit(status, tradestate.Closed) && timeExpire != nil && !time.Now().Before(*timeExpire)
+}
+
+// CloseExpiredOrder 支付前校验订单有效期：已过期时立即关闭订单 (合单子单关闭整个合单) 并返回 ErrOrderExpired
+func CloseExpiredOrder(tx model.Transaction) error {
+	if tx.CombineID != 0 {
+		var order model.CombineOrder
+		if err := core.DB.First(&order, tx.CombineID).Error; err != nil {
+			return nil
+		}
+		return CloseExpiredCombineOrder(order)
+	}
+
+	if !IsOrderExpired(tx.Status, tx.TimeExpire) {
+		return nil
+	}
+	// 按可关闭状态条件更新，避免覆盖并发的支付结果
+	result := core.DB.Model(&model.Transaction{}).Where("id = ? AND status IN ?", tx.ID, tradestate.Sources(tradestate.Closed)).
+		Update("status", tradestate.Closed)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 订单状态已变更：已被定时任务关闭时仍返回过期错误
+		if core.DB.First(&tx, tx.ID).Error != nil || tx.Status != tradestate.Closed {
+			return nil
+		}
+	}
+	return ErrOrderExpired
+}
+
+// CloseExpiredCombineOrder 合单已超过 time_expire 时关闭合单及其子单并返回 ErrOrderExpired
+func CloseExpiredCombineOrder(order model.CombineOrder) error {
+	if !IsOrderExpired(order.Status, order.TimeExpire) {
+		return nil
+	}
+	if err := CloseCombineOrder(order.ID); err != nil {
+		// 合单状态已变更：已被定时任务关闭时仍返回过期错误
+		if !errors.Is(err, ErrCombineOrderChanged) || core.DB.First(&order, order.ID).Error != nil || order.Status != tradestate.Closed {
+			return err
+		}
+	}
+	return ErrOrderExpired
+}
+
+// ErrCombineOrderChanged 关闭合单时合单已不是未支付状态 (如并发支付成功)
+var ErrCombineOrderChanged = NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "合单状态已变更，请重新查询")
+
+// CloseCombineOrder 在同一事务内关闭合单及其未支付的子单
+// 按合单未支付状态条件更新，合单状态已变更时整单回滚并返回 ErrCombineOrderChanged
+func CloseCombineOrder(combineID uint) error {
+	return core.DB.Transaction(func(db *gorm.DB) error {
+		if err := db.Model(&model.Transaction{}).Where("combine_id = ? AND status IN ?", combineID, tradestate.Sources(tradestate.Closed)).
+			Update("status", tradestate.Closed).Error; err != nil {
+			return err
+		}
+		result := db.Model(&model.CombineOrder{}).Where("id = ? AND status = ?", combineID, tradestate.NotPay).
+			Update("status", tradestate.Closed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCombineOrderChanged
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+)
+
+func TestCloseCombineOrder(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+
+	tests := []struct {
+		name      string
+		status    string // 合单状态
+		subStatus string // 子单状态
+		wantErr   error
+		wantState string // 关单后的合单及子单状态
+	}{
+		{"not paid", tradestate.NotPay, tradestate.NotPay, nil, tradestate.Closed},
+		{"paid", tradestate.Success, tradestate.Success, ErrCombineOrderChanged, tradestate.Success},
+		{"closed", tradestate.Closed, tradestate.Closed, ErrCombineOrderChanged, tradestate.Closed},
+	}
+	for _, tt := range tests {
+		order := model.CombineOrder{
+			CombineMchID:      "100",
+			CombineOutTradeNo: "COMBINE_" + tt.name,
+			Status:            tt.status,
+			SubOrders: []model.Transaction{
+				{MchID: "100", OutTradeNo: "SUB_" + tt.name + "_1", TransactionID: "4200_" + tt.name + "_1", Status: tt.subStatus},
+				{MchID: "200", OutTradeNo: "SUB_" + tt.name + "_2", TransactionID: "4200_" + tt.name + "_2", Status: tt.subStatus},
+			},
+		}
+		core.DB.Create(&order)
+
+		if err := CloseCombineOrder(order.ID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		core.DB.Preload("SubOrders").First(&order, order.ID)
+		if order.Status != tt.wantState {
+			t.Errorf("%s: combine status = %s, want %s", tt.name, order.Status, tt.wantState)
+		}
+		for _, sub := range order.SubOrders {
+			if sub.Status != tt.wantState {
+				t.Errorf("%s: sub order %s status = %s, want %s", tt.name, sub.OutTradeNo, sub.Status, tt.wantState)
+			}
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+	"wepay-sandbox/internal/worker"
+
+	"gorm.io/gorm"
+)
+
+// profitSharingDelay 分账及分账回退的处理时长
+const profitSharingDelay = 2 * time.Second
+
+// maxProfitSharingReceivers 单次分账最多接收方数量
+const maxProfitSharingReceivers = 50
+
+// profitSharingLock 串行化分账及回退申请，保证可分金额校验与创建之间的一致性
+var profitSharingLock sync.Mutex
+
+// receiverTypes 分账接收方类型
+var receiverTypes = map[string]bool{"MERCHANT_ID": true, "PERSONAL_OPENID": true, "PERSONAL_SUB_OPENID": true}
+
+// relationTypes 与分账方的关系类型
+var relationTypes = map[string]bool{
+	"STORE": true, "STAFF": true, "STORE_OWNER": true, "PARTNER": true, "HEADQUARTER": true,
+	"BRAND": true, "DISTRIBUTOR": true, "USER": true, "SUPPLIER": true, "CUSTOM": true,
+}
+
+// AddProfitSharingReceiver 添加分账接收方，已存在时更新接收方信息
+// name 为平台证书公钥加密的密文，无法解密时按明文保存
+func AddProfitSharingReceiver(r model.ProfitSharingReceiver) (model.ProfitSharingReceiver, error) {
+	if !receiverTypes[r.Type] {
+		return r, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "type只能为MERCHANT_ID、PERSONAL_OPENID或PERSONAL_SUB_OPENID")
+	}
+	if r.Account == "" {
+		return r, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "account is required")
+	}
+	if !relationTypes[r.RelationType] {
+		return r, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "relation_type不合法")
+	}
+	if r.RelationType == "CUSTOM" && r.CustomRelation == "" {
+		return r, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "relation_type为CUSTOM时custom_relation必填")
+	}
+	if r.Type == "MERCHANT_ID" {
+		if r.Name == "" {
+			return r, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "分账接收方类型为MERCHANT_ID时name必填")
+		}
+		if r.Account == r.MchID {
+			return r, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "不能添加分账方自身为分账接收方")
+		}
+	}
+
+	if r.Name != "" {
+		decryptMchID := r.MchID
+		if r.SpMchID != "" {
+			decryptMchID = r.SpMchID
+		}
+		r.Name = core.DecryptSensitive(decryptMchID, r.Name)
+	}
+
+	var existing model.ProfitSharingReceiver
+	err := core.DB.Where("mch_id = ? AND type = ? AND account = ?", r.MchID, r.Type, r.Account).First(&existing).Error
+	if err == nil {
+		r.ID = existing.ID
+		r.CreatedAt = existing.CreatedAt
+		return r, core.DB.Save(&r).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return r, err
+	}
+	return r, core.DB.Create(&r).Error
+}
+
+// DeleteProfitSharingReceiver 删除分账接收方，已受理的分账单中该接收方的分账将失败
+func DeleteProfitSharingReceiver(mchid, receiverType, account string) error {
+	result := core.DB.Where("mch_id = ? AND type = ? AND account = ?", mchid, receiverType, account).Delete(&model.ProfitSharingReceiver{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewBizError(http.StatusNotFound, "RESOURCE_NOT_EXISTS", "分账接收方不存在")
+	}
+	return nil
+}
+
+// ProfitSharingReceiverParams 分账接收方及分账金额
+type ProfitSharingReceiverParams struct {
+	Type        string
+	Account     string
+	Amount      int64
+	Description string
+}
+
+// CreateProfitSharing 请求分账，分账单以 PROCESSING 受理并异步完成
+// unfreezeUnsplit 为 true 时本次分账后剩余待分金额同时解冻给分账方
+func CreateProfitSharing(tx model.Transaction, outOrderNo string, receivers []ProfitSharingReceiverParams, unfreezeUnsplit bool) (model.ProfitSharingOrder, error) {
+	if len(receivers) == 0 || len(receivers) > maxProfitSharingReceivers {
+		return model.ProfitSharingOrder{}, NewBizError(http.StatusBadRequest, "PARAM_ERROR", fmt.Sprintf("receivers must contain 1 to %d items", maxProfitSharingReceivers))
+	}
+
+	var details []model.ProfitSharingDetail
+	for _, r := range receivers {
+		if r.Amount <= 0 {
+			return model.ProfitSharingOrder{}, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "分账金额必须大于 0")
+		}
+		if r.Description == "" {
+			return model.ProfitSharingOrder{}, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "receivers.description is required")
+		}
+		var receiver model.ProfitSharingReceiver
+		if core.DB.Where("mch_id = ? AND type = ? AND account = ?", tx.MchID, r.Type, r.Account).First(&receiver).Error != nil {
+			return model.ProfitSharingOrder{}, NewBizError(http.StatusBadRequest, "RECEIVER_INVALID", "分账接收方未添加: "+r.Account)
+		}
+		details = append(details, model.ProfitSharingDetail{
+			Type:        r.Type,
+			Account:     r.Account,
+			Amount:      r.Amount,
+			Description: r.Description,
+		})
+	}
+
+	return createProfitSharingOrder(tx, outOrderNo, details, unfreezeUnsplit)
+}
+
+// UnfreezeProfitSharing 解冻剩余资金：订单剩余待分金额全部解冻给分账方
+func UnfreezeProfitSharing(tx model.Transaction, outOrderNo, description string) (model.ProfitSharingOrder, error) {
+	if description == "" {
+		return model.ProfitSharingOrder{}, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "description is required")
+	}
+	return createProfitSharingOrder(tx, outOrderNo, nil, true)
+}
+
+// createProfitSharingOrder 校验订单及可分金额后保存分账单，需要解冻时追加解冻给分账方的明细
+func createProfitSharingOrder(tx model.Transaction, outOrderNo string, details []model.ProfitSharingDetail, unfreeze bool) (model.ProfitSharingOrder, error) {
+	var order model.ProfitSharingOrder
+
+	if outOrderNo == "" {
+		return order, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "out_order_no is required")
+	}
+	if !tx.ProfitSharing {
+		return order, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "订单下单时未指定分账 (settle_info.profit_sharing)，不能分账")
+	}
+	if tx.Status != tradestate.Success && tx.Status != tradestate.Refund {
+		return order, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "订单未支付成功，不能分账")
+	}
+
+	profitSharingLock.Lock()
+	defer profitSharingLock.Unlock()
+
+	// 同一商户分账单号重复提交时返回原分账单
+	err := core.DB.Preload("Receivers").Where("out_order_no = ? AND mch_id = ?", outOrderNo, tx.MchID).First(&order).Error
+	if err == nil {
+		if order.TransactionID != tx.TransactionID {
+			return order, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "商户分账单号重复，且与原请求的订单不一致")
+		}
+		return order, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return order, err
+	}
+
+	unsplit := UnsplitAmount(tx)
+	var total int64
+	for _, d := range details {
+		total += d.Amount
+	}
+	if unsplit == 0 {
+		return order, NewBizError(http.StatusForbidden, "NOT_ENOUGH", "订单剩余待分金额为 0")
+	}
+	if total > unsplit {
+		return order, NewBizError(http.StatusForbidden, "NOT_ENOUGH", "分账金额超过订单剩余待分金额")
+	}
+	if unfreeze && unsplit > total {
+		details = append(details, model.ProfitSharingDetail{
+			Type:        "MERCHANT_ID",
+			Account:     tx.MchID,
+			Amount:      unsplit - total,
+			Description: "解冻给分账方",
+		})
+	}
+
+	now := time.Now()
+	order = model.ProfitSharingOrder{
+		OrderID:         fmt.Sprintf("3008450740%s%06d", now.Format("20060102150405"), rand.Intn(1000000)),
+		OutOrderNo:      outOrderNo,
+		TransactionID:   tx.TransactionID,
+		MchID:           tx.MchID,
+		SpMchID:         tx.SpMchID,
+		State:           "PROCESSING",
+		UnfreezeUnsplit: unfreeze,
+	}
+	for i := range details {
+		details[i].DetailID = fmt.Sprintf("3600000%s%03d%06d", now.Format("20060102150405"), i, rand.Intn(1000000))
+		details[i].Result = "PENDING"
+	}
+	order.Receivers = details
+
+	if err := core.DB.Create(&order).Error; err != nil {
+		return order, err
+	}
+
+	scheduleProfitSharing(order.OrderID)
+	return order, nil
+}
+
+// UnsplitAmount 订单剩余待分金额：订单金额 - 已退款金额 - 已分账 (含解冻) 金额
+func UnsplitAmount(tx model.Transaction) int64 {
+	if !tx.ProfitSharing {
+		return 0
+	}
+
+	var shared int64
+	core.DB.Model(&model.ProfitSharingDetail{}).
+		Joins("JOIN profit_sharing_orders ON profit_sharing_orders.id = profit_sharing_details.profit_sharing_order_id").
+		Where("profit_sharing_orders.transaction_id = ? AND profit_sharing_details.result <> ?", tx.TransactionID, "CLOSED").
+		Select("COALESCE(SUM(profit_sharing_details.amount), 0)").
+		Scan(&shared)
+
+	unsplit := tx.Amount - RefundedAmount(tx.TransactionID) - shared
+	if unsplit < 0 {
+		return 0
+	}
+	return unsplit
+}
+
+// scheduleProfitSharing 延迟完成分账单：接收方仍存在时分账成功，否则该接收方分账关闭
+func scheduleProfitSharing(orderID string) {
+	time.AfterFunc(profitSharingDelay, func() {
+		finishProfitSharing(orderID)
+	})
+}
+
+// finishProfitSharing 完成分账单并发送分账动账通知 (解冻给分账方的明细不通知)
+func finishProfitSharing(orderID string) {
+	var order model.ProfitSharingOrder
+	if err := core.DB.Preload("Receivers").Where("order_id = ?", orderID).First(&order).Error; err != nil || order.State != "PROCESSING" {
+		return
+	}
+
+	now := time.Now()
+	for i, d := range order.Receivers {
+		if d.Result != "PENDING" {
+			continue
+		}
+		result, reason := "SUCCESS", ""
+		if d.Account != order.MchID {
+			var receiver model.ProfitSharingReceiver
+			if core.DB.Where("mch_id = ? AND type = ? AND account = ?", order.MchID, d.Type, d.Account).First(&receiver).Error != nil {
+				result, reason = "CLOSED", "RECEIVER_INVALID"
+			}
+		}
+		core.DB.Model(&order.Receivers[i]).Updates(map[string]interface{}{
+			"result":      result,
+			"fail_reason": reason,
+			"finished_at": now,
+		})
+	}
+	core.DB.Model(&order).Update("state", "FINISHED")
+
+	core.DB.Preload("Receivers").First(&order, order.ID)
+	for _, d := range order.Receivers {
+		if d.Account != order.MchID {
+			worker.TriggerProfitSharingCallback(order, d)
+		}
+	}
+}
+
+// ResumeProfitSharing 服务启动时重新调度处理中的分账单及回退单
+func ResumeProfitSharing() {
+	var orders []model.ProfitSharingOrder
+	core.DB.Where("state = ?", "PROCESSING").Find(&orders)
+	for _, order := range orders {
+		scheduleProfitSharing(order.OrderID)
+	}
+
+	var returns []model.ProfitSharingReturn
+	core.DB.Where("result = ?", "PROCESSING").Find(&returns)
+	for _, ret := range returns {
+		scheduleProfitSharingReturn(ret.ReturnID)
+	}
+}
+
+// ProfitSharingReturnParams 分账回退参数
+type ProfitSharingReturnParams struct {
+	OutReturnNo string
+	ReturnMchID string // 回退商户号，必须是该分账单中分账成功的商户类型接收方
+	Amount      int64
+	Description string
+}
+
+// CreateProfitSharingReturn 分账回退：将已分给商户接收方的资金退回分账方，回退单以 PROCESSING 受理并异步完成
+func CreateProfitSharingReturn(order model.ProfitSharingOrder, p ProfitSharingReturnParams) (model.ProfitSharingReturn, error) {
+	var ret model.ProfitSharingReturn
+
+	if p.OutReturnNo == "" || p.ReturnMchID == "" || p.Description == "" {
+		return ret, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "out_return_no, return_mchid and description are required")
+	}
+	if p.Amount <= 0 {
+		return ret, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "回退金额必须大于 0")
+	}
+
+	profitSharingLock.Lock()
+	defer profitSharingLock.Unlock()
+
+	// 同一商户回退单号重复提交：参数一致时返回原回退单
+	err := core.DB.Where("out_return_no = ? AND mch_id = ?", p.OutReturnNo, order.MchID).First(&ret).Error
+	if err == nil {
+		if ret.OrderID != order.OrderID || ret.ReturnMchID != p.ReturnMchID || ret.Amount != p.Amount {
+			return ret, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "商户回退单号重复，且回退参数与原请求不一致")
+		}
+		return ret, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ret, err
+	}
+
+	var shared int64
+	for _, d := range order.Receivers {
+		if d.Type == "MERCHANT_ID" && d.Account == p.ReturnMchID && d.Account != order.MchID && d.Result == "SUCCESS" {
+			shared += d.Amount
+		}
+	}
+	if shared == 0 {
+		return ret, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "回退商户不是该分账单中分账成功的接收方")
+	}
+
+	var returned int64
+	core.DB.Model(&model.ProfitSharingReturn{}).
+		Where("order_id = ? AND return_mch_id = ? AND result <> ?", order.OrderID, p.ReturnMchID, "FAILED").
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&returned)
+	if p.Amount > shared-returned {
+		return ret, NewBizError(http.StatusForbidden, "NOT_ENOUGH", "回退金额超过可回退金额")
+	}
+
+	ret = model.ProfitSharingReturn{
+		ReturnID:    fmt.Sprintf("3008450740%s%06d", time.Now().Format("20060102150405"), rand.Intn(1000000)),
+		OutReturnNo: p.OutReturnNo,
+		OrderID:     order.OrderID,
+		OutOrderNo:  order.OutOrderNo,
+		MchID:       order.MchID,
+		SpMchID:     order.SpMchID,
+		ReturnMchID: p.ReturnMchID,
+		Amount:      p.Amount,
+		Description: p.Description,
+		Result:      "PROCESSING",
+	}
+	if err := core.DB.Create(&ret).Error; err != nil {
+		return ret, err
+	}
+
+	scheduleProfitSharingReturn(ret.ReturnID)
+	return ret, nil
+}
+
+// scheduleProfitSharingReturn 延迟完成回退单：回退商户未在沙箱配置时回退失败
+func scheduleProfitSharingReturn(returnID string) {
+	time.AfterFunc(profitSharingDelay, func() {
+		var ret model.ProfitSharingReturn
+		if err := core.DB.Where("return_id = ?", returnID).First(&ret).Error; err != nil || ret.Result != "PROCESSING" {
+			return
+		}
+
+		result, reason := "SUCCESS", ""
+		var mch model.Merchant
+		if core.DB.Where("mch_id = ?", ret.ReturnMchID).First(&mch).Error != nil {
+			result, reason = "FAILED", "ACCOUNT_ABNORMAL"
+		}
+		core.DB.Model(&ret).Updates(map[string]interface{}{
+			"result":      result,
+			"fail_reason": reason,
+			"finished_at": time.Now(),
+		})
+
+		if result == "SUCCESS" {
+			core.DB.First(&ret, ret.ID)
+			worker.TriggerProfitSharingReturnCallback(ret)
+		}
+	})
+}
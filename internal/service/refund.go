@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+
+	"gorm.io/gorm"
+)
+
+// DefaultRefundWindowDays 默认可退款期限 (支付完成后 365 天)
+const DefaultRefundWindowDays = 365
+
+// refundLock 串行化退款申请，保证累计退款金额校验与创建之间的一致性
+var refundLock sync.Mutex
+
+// RefundParams 退款申请参数
+type RefundParams struct {
+	OutRefundNo  string // 商户退款单号，为空时自动生成
+	Amount       int64  // 退款金额 (分)
+	Reason       string
+	NotifyUrl    string // 退款回调地址，为空时使用商户配置
+	FundsAccount string // 退款资金来源
+}
+
+// CreateRefund 对支付订单发起退款，退款单以 PROCESSING 状态创建，并按商户配置异步推进
+func CreateRefund(tx model.Transaction, p RefundParams) (model.Refund, error) {
+	var refund model.Refund
+
+	if tx.Status != tradestate.Success && tx.Status != tradestate.Refund {
+		return refund, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "订单状态不正确，无法退款")
+	}
+
+	if p.Amount <= 0 {
+		return refund, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "退款金额必须大于 0")
+	}
+
+	// 退款单号幂等、可退金额校验与创建之间串行，避免并发重复提交创建多笔退款
+	refundLock.Lock()
+	defer refundLock.Unlock()
+
+	// 同一商户退款单号重复提交：参数一致时返回原退款单
+	if p.OutRefundNo != "" {
+		var existing model.Refund
+		err := core.DB.Where("out_refund_no = ? AND mch_id = ?", p.OutRefundNo, tx.MchID).First(&existing).Error
+		if err == nil {
+			if existing.TransactionID != tx.TransactionID || existing.Amount != p.Amount {
+				return refund, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "商户退款单号重复，且退款参数与原请求不一致")
+			}
+			return existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return refund, err
+		}
+	}
+
+	var mch model.Merchant
+	core.DB.Where("mch_id = ?", tx.MchID).First(&mch)
+
+	// 校验退款期限 (自支付完成时间起算，缺少支付时间的订单视为已超期)
+	windowDays := mch.RefundWindowDays
+	if windowDays <= 0 {
+		windowDays = DefaultRefundWindowDays
+	}
+	if tx.PaidAt == nil || time.Since(*tx.PaidAt) > time.Duration(windowDays)*24*time.Hour {
+		return refund, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "订单已超过可退款的最大期限")
+	}
+
+	// 校验累计退款金额
+	if p.Amount > tx.Amount-RefundedAmount(tx.TransactionID) {
+		return refund, NewBizError(http.StatusForbidden, "NOT_ENOUGH", "申请退款金额超过订单可退金额")
+	}
+
+	// 获取商户退款配置 (服务商模式下回调地址取服务商配置)
+	notifyMch := mch
+	if tx.SpMchID != "" {
+		notifyMch = model.Merchant{}
+		core.DB.Where("mch_id = ?", tx.SpMchID).First(&notifyMch)
+	}
+	notifyUrl := p.NotifyUrl
+	if notifyUrl == "" {
+		notifyUrl = notifyMch.RefundNotifyUrl
+		if notifyUrl == "" {
+			notifyUrl = notifyMch.NotifyUrl // Fallback
+		}
+	}
+
+	outRefundNo := p.OutRefundNo
+	if outRefundNo == "" {
+		outRefundNo = fmt.Sprintf("REF_OUT_%d", time.Now().UnixNano())
+	}
+	fundsAccount := p.FundsAccount
+	if fundsAccount == "" {
+		fundsAccount = "AVAILABLE"
+	}
+
+	refund = model.Refund{
+		RefundID:            fmt.Sprintf("503000%s%06d", time.Now().Format("20060102150405"), rand.Intn(1000000)),
+		OutRefundNo:         outRefundNo,
+		TransactionID:       tx.TransactionID,
+		MchID:               tx.MchID,
+		SpMchID:             tx.SpMchID,
+		Amount:              p.Amount,
+		Total:               tx.Amount,
+		Currency:            tx.Currency,
+		Reason:              p.Reason,
+		Status:              "PROCESSING",
+		FundsAccount:        fundsAccount,
+		Channel:             "ORIGINAL",
+		UserReceivedAccount: "支付用户零钱",
+		NotifyUrl:           notifyUrl,
+	}
+
+	if err := core.DB.Create(&refund).Error; err != nil {
+		return refund, err
+	}
+
+	// 更新原订单状态 (标记为 REFUND)，按状态条件更新，避免以旧数据覆盖订单
+	core.DB.Model(&model.Transaction{}).Where("id = ? AND status IN ?", tx.ID, tradestate.Sources(tradestate.Refund)).
+		Update("status", tradestate.Refund)
+
+	// 异步处理退款 (完成后发送退款通知)
+	scheduleRefund(refund)
+
+	return refund, nil
+}
+
+// RefundedAmount 获取支付订单累计已退款金额 (不含已关闭的退款)
+func RefundedAmount(transactionID string) int64 {
+	return RefundedAmounts([]string{transactionID})[transactionID]
+}
+
+// RefundedAmounts 批量获取支付订单累计已退款金额，key 为 TransactionID
+func RefundedAmounts(transactionIDs []string) map[string]int64 {
+	var rows []struct {
+		TransactionID string
+		Total         int64
+	}
+	core.DB.Model(&model.Refund{}).
+		Select("transaction_id, SUM(amount) AS total").
+		Where("transaction_id IN ? AND status <> ?", transactionIDs, "CLOSED").
+		Group("transaction_id").
+		Scan(&rows)
+
+	result := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		result[row.TransactionID] = row.Total
+	}
+	return result
+}
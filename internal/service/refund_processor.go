@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+	"wepay-sandbox/internal/worker"
+)
+
+// RefundConfig 退款处理配置 (商户 refund_config 字段)
+type RefundConfig struct {
+	Delay  string `json:"delay"`  // 处理时长，e.g. "5s"
+	Result string `json:"result"` // 处理结果：SUCCESS, ABNORMAL, CLOSED；MANUAL 表示保持处理中，等待手动操作
+}
+
+// loadRefundConfig 读取商户退款处理配置，默认 3 秒后退款成功
+func loadRefundConfig(mchid string) (time.Duration, string) {
+	delay := 3 * time.Second
+	result := "SUCCESS"
+
+	var mch model.Merchant
+	if err := core.DB.Where("mch_id = ?", mchid).First(&mch).Error; err == nil {
+		var config RefundConfig
+		if json.Unmarshal([]byte(mch.RefundConfig), &config) == nil {
+			if d, err := time.ParseDuration(config.Delay); err == nil {
+				delay = d
+			}
+			if config.Result != "" {
+				result = config.Result
+			}
+		}
+	}
+	return delay, result
+}
+
+// scheduleRefund 按商户配置在延迟后推进退款状态
+func scheduleRefund(refund model.Refund) {
+	delay, result := loadRefundConfig(refund.MchID)
+	scheduleRefundResult(refund.RefundID, delay, result)
+}
+
+// scheduleRefundResult 在延迟后将退款推进到指定结果，MANUAL 时不做处理
+func scheduleRefundResult(refundID string, delay time.Duration, result string) {
+	if result == "MANUAL" {
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		if _, err := CompleteRefund(refundID, result); err != nil {
+			fmt.Printf("Refund %s auto process skipped: %v\n", refundID, err)
+		}
+	})
+}
+
+// ResumeRefunds 服务启动时重新调度所有处理中的退款
+func ResumeRefunds() {
+	var refunds []model.Refund
+	core.DB.Where("status = ?", "PROCESSING").Find(&refunds)
+	for _, refund := range refunds {
+		scheduleRefund(refund)
+	}
+}
+
+// CompleteRefund 将处理中的退款推进到 SUCCESS / ABNORMAL / CLOSED，并发送对应的退款通知
+func CompleteRefund(refundID, status string) (model.Refund, error) {
+	var refund model.Refund
+
+	switch status {
+	case "SUCCESS", "ABNORMAL", "CLOSED":
+	default:
+		return refund, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "退款状态只能为 SUCCESS、ABNORMAL 或 CLOSED")
+	}
+
+	refundLock.Lock()
+	defer refundLock.Unlock()
+
+	if err := core.DB.Where("refund_id = ?", refundID).First(&refund).Error; err != nil {
+		return refund, NewBizError(http.StatusNotFound, "RESOURCE_NOT_EXISTS", "退款单不存在")
+	}
+	if refund.Status != "PROCESSING" {
+		return refund, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "退款单当前状态为 "+refund.Status+"，无法变更")
+	}
+
+	updates := map[string]interface{}{
+		"status":          status,
+		"callback_status": "",
+		"callback_msg":    "",
+	}
+	if status == "SUCCESS" {
+		updates["success_at"] = time.Now()
+	}
+	if err := core.DB.Model(&refund).Updates(updates).Error; err != nil {
+		return refund, err
+	}
+
+	if status == "CLOSED" {
+		restoreRefundedOrder(refund.TransactionID)
+	}
+
+	core.DB.First(&refund, refund.ID)
+	worker.TriggerRefundCallback(refund)
+
+	return refund, nil
+}
+
+// restoreRefundedOrder 退款关闭后资金未退出，若订单已无其他有效退款则由 REFUND 恢复为 SUCCESS
+// 该恢复不属于 tradestate 的支付流转，仅在退款关闭时按 REFUND 状态条件更新
+func restoreRefundedOrder(transactionID string) {
+	if RefundedAmount(transactionID) != 0 {
+		return
+	}
+	core.DB.Model(&model.Transaction{}).
+		Where("transaction_id = ? AND status = ?", transactionID, tradestate.Refund).
+		Update("status", tradestate.Success)
+}
+
+// AbnormalRefundParams 异常退款处理参数
+type AbnormalRefundParams struct {
+	OutRefundNo string
+	Type        string // USER_BANK_CARD: 退款至用户银行卡；MERCHANT_BANK_CARD: 退款至交易商户银行账户
+	BankType    string
+	BankAccount string // 使用平台证书公钥加密
+	RealName    string // 使用平台证书公钥加密
+}
+
+// ApplyAbnormalRefund 对异常退款发起重新入账，退款单回到 PROCESSING 并在处理完成后成功
+func ApplyAbnormalRefund(refundID string, p AbnormalRefundParams) (model.Refund, error) {
+	var refund model.Refund
+
+	refundLock.Lock()
+	defer refundLock.Unlock()
+
+	if err := core.DB.Where("refund_id = ?", refundID).First(&refund).Error; err != nil {
+		return refund, NewBizError(http.StatusNotFound, "RESOURCE_NOT_EXISTS", "退款单不存在")
+	}
+	if p.OutRefundNo != refund.OutRefundNo {
+		return refund, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "out_refund_no与退款单不匹配")
+	}
+	if refund.Status != "ABNORMAL" {
+		return refund, NewBizError(http.StatusForbidden, "INVALID_REQUEST", "退款单状态不是ABNORMAL，无法发起异常退款")
+	}
+
+	var account string
+	switch p.Type {
+	case "USER_BANK_CARD":
+		if p.BankType == "" || p.BankAccount == "" || p.RealName == "" {
+			return refund, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "退款至用户银行卡时bank_type、bank_account、real_name必填")
+		}
+		// 服务商模式下敏感字段使用服务商的平台证书加密
+		decryptMchID := refund.MchID
+		if refund.SpMchID != "" {
+			decryptMchID = refund.SpMchID
+		}
+		bankAccount := core.DecryptSensitive(decryptMchID, p.BankAccount)
+		if len(bankAccount) > 4 {
+			bankAccount = bankAccount[len(bankAccount)-4:]
+		}
+		account = p.BankType + " 尾号" + bankAccount
+	case "MERCHANT_BANK_CARD":
+		account = "商户银行卡"
+	default:
+		return refund, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "type只能为USER_BANK_CARD或MERCHANT_BANK_CARD")
+	}
+
+	updates := map[string]interface{}{
+		"status":                "PROCESSING",
+		"channel":               "OTHER_BANKCARD",
+		"user_received_account": account,
+		"callback_status":       "",
+		"callback_msg":          "",
+	}
+	if err := core.DB.Model(&refund).Updates(updates).Error; err != nil {
+		return refund, err
+	}
+	core.DB.First(&refund, refund.ID)
+
+	// 重新入账只会成功 (MANUAL 时等待手动处理)
+	delay, result := loadRefundConfig(refund.MchID)
+	if result != "MANUAL" {
+		result = "SUCCESS"
+	}
+	scheduleRefundResult(refund.RefundID, delay, result)
+
+	return refund, nil
+}
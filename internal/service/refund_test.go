@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+)
+
+func TestCreateRefund(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	for _, mchid := range []string{"100", "200"} {
+		core.DB.Create(&model.Merchant{AppID: "wx" + mchid, MchID: mchid})
+	}
+
+	now := time.Now()
+	newOrder := func(mchid, transactionID string) model.Transaction {
+		tx := model.Transaction{
+			AppID:         "wx" + mchid,
+			MchID:         mchid,
+			OutTradeNo:    "ORDER_" + transactionID,
+			TransactionID: transactionID,
+			Amount:        100,
+			Currency:      "CNY",
+			Status:        "SUCCESS",
+			PaidAt:        &now,
+		}
+		core.DB.Create(&tx)
+		return tx
+	}
+	order := newOrder("100", "4200000001")
+	other := newOrder("100", "4200000002")
+	otherMch := newOrder("200", "4200000003")
+	expired := newOrder("100", "4200000004")
+	paidAt := now.AddDate(0, 0, -DefaultRefundWindowDays-1)
+	expired.PaidAt = &paidAt
+	unknownPaidAt := newOrder("100", "4200000005")
+	unknownPaidAt.PaidAt = nil
+	var firstRefundID string
+	tests := []struct {
+		name       string
+		tx         model.Transaction
+		p          RefundParams
+		wantStatus int    // 0 表示成功
+		wantCode   string // 失败时的错误码
+		wantSame   bool   // 幂等：返回首次创建的退款单
+	}{
+		{"partial refund", order, RefundParams{OutRefundNo: "REFUND_1", Amount: 60}, 0, "", false},
+		{"retry same params", order, RefundParams{OutRefundNo: "REFUND_1", Amount: 60}, 0, "", true},
+		{"retry different amount", order, RefundParams{OutRefundNo: "REFUND_1", Amount: 50}, http.StatusBadRequest, "INVALID_REQUEST", false},
+		{"retry on another order", other, RefundParams{OutRefundNo: "REFUND_1", Amount: 60}, http.StatusBadRequest, "INVALID_REQUEST", false},
+		{"same out_refund_no on another merchant", otherMch, RefundParams{OutRefundNo: "REFUND_1", Amount: 60}, 0, "", false},
+		{"exceeds refundable amount", order, RefundParams{OutRefundNo: "REFUND_2", Amount: 41}, http.StatusForbidden, "NOT_ENOUGH", false},
+		{"refund remaining amount", order, RefundParams{OutRefundNo: "REFUND_2", Amount: 40}, 0, "", false},
+		{"fully refunded", order, RefundParams{OutRefundNo: "REFUND_3", Amount: 1}, http.StatusForbidden, "NOT_ENOUGH", false},
+		{"zero amount", other, RefundParams{OutRefundNo: "REFUND_4", Amount: 0}, http.StatusBadRequest, "PARAM_ERROR", false},
+		{"beyond refund window", expired, RefundParams{OutRefundNo: "REFUND_5", Amount: 1}, http.StatusBadRequest, "INVALID_REQUEST", false},
+		{"missing paid_at", unknownPaidAt, RefundParams{OutRefundNo: "REFUND_6", Amount: 1}, http.StatusBadRequest, "INVALID_REQUEST", false},
+		{"unpaid order", model.Transaction{MchID: "100", Status: "NOTPAY"}, RefundParams{Amount: 1}, http.StatusBadRequest, "INVALID_REQUEST", false},
+	}
+
+	for _, tt := range tests {
+		refund, err := CreateRefund(tt.tx, tt.p)
+		if tt.wantStatus != 0 {
+			status, code, _ := ErrorDetail(err)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("%s: err = %d %s (%v), want %d %s", tt.name, status, code, err, tt.wantStatus, tt.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if refund.Amount != tt.p.Amount || refund.MchID != tt.tx.MchID {
+			t.Errorf("%s: refund = %d %s", tt.name, refund.Amount, refund.MchID)
+		}
+		switch {
+		case firstRefundID == "":
+			firstRefundID = refund.RefundID
+		case tt.wantSame && refund.RefundID != firstRefundID:
+			t.Errorf("%s: refund_id = %s, want original %s", tt.name, refund.RefundID, firstRefundID)
+		case !tt.wantSame && refund.RefundID == firstRefundID:
+			t.Errorf("%s: returned the original refund", tt.name)
+		}
+	}
+
+	if got := RefundedAmount(order.TransactionID); got != order.Amount {
+		t.Errorf("RefundedAmount = %d, want %d", got, order.Amount)
+	}
+	var count int64
+	core.DB.Model(&model.Refund{}).Where("transaction_id = ?", order.TransactionID).Count(&count)
+	if count != 2 {
+		t.Errorf("refund count = %d, want 2", count)
+	}
+	core.DB.First(&order, order.ID)
+	if order.Status != "REFUND" {
+		t.Errorf("order status = %s, want REFUND", order.Status)
+	}
+}
+
+func TestCreateRefundConcurrentRetry(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	core.DB.Create(&model.Merchant{AppID: "wx100", MchID: "100"})
+	now := time.Now()
+	tx := model.Transaction{AppID: "wx100", MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000001", Amount: 100, Status: "SUCCESS", PaidAt: &now}
+	core.DB.Create(&tx)
+
+	// 同一退款单号并发重复提交只创建一笔退款
+	const n = 8
+	refundIDs := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refund, err := CreateRefund(tx, RefundParams{OutRefundNo: "REFUND_1", Amount: 60})
+			if err != nil {
+				t.Errorf("CreateRefund: %v", err)
+				return
+			}
+			refundIDs <- refund.RefundID
+		}()
+	}
+	wg.Wait()
+	close(refundIDs)
+
+	seen := map[string]bool{}
+	for id := range refundIDs {
+		seen[id] = true
+	}
+	var count int64
+	core.DB.Model(&model.Refund{}).Where("out_refund_no = ?", "REFUND_1").Count(&count)
+	if len(seen) != 1 || count != 1 {
+		t.Errorf("refund_ids = %v, refund count = %d, want a single refund", seen, count)
+	}
+}
+
+func TestApplyAbnormalRefund(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	// MANUAL：重新入账后保持处理中，不触发异步处理及回调
+	for _, mchid := range []string{"100", "300", "400"} {
+		core.DB.Create(&model.Merchant{AppID: "wx" + mchid, MchID: mchid, RefundConfig: `{"result": "MANUAL"}`})
+	}
+
+	// encrypt 使用商户平台证书公钥加密敏感字段
+	encrypt := func(mchid, plaintext string) string {
+		cert, err := core.GetPlatformCert(mchid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _, err := core.ParseRSAPublicKey(cert.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, []byte(plaintext), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	tests := []struct {
+		name        string
+		refund      model.Refund
+		bankAccount string
+		wantAccount string
+	}{
+		{"merchant", model.Refund{RefundID: "5030000001", OutRefundNo: "REFUND_1", MchID: "100"}, encrypt("100", "6222000011111111"), "ICBC_DEBIT 尾号1111"},
+		{"partner encrypted by sp_mchid", model.Refund{RefundID: "5030000002", OutRefundNo: "REFUND_2", MchID: "400", SpMchID: "300"}, encrypt("300", "6222000022222222"), "ICBC_DEBIT 尾号2222"},
+		{"plaintext", model.Refund{RefundID: "5030000003", OutRefundNo: "REFUND_3", MchID: "100"}, "6222000033333333", "ICBC_DEBIT 尾号3333"},
+	}
+	for _, tt := range tests {
+		tt.refund.TransactionID, tt.refund.Amount, tt.refund.Status = "4200000001", 100, "ABNORMAL"
+		core.DB.Create(&tt.refund)
+
+		refund, err := ApplyAbnormalRefund(tt.refund.RefundID, AbnormalRefundParams{
+			OutRefundNo: tt.refund.OutRefundNo,
+			Type:        "USER_BANK_CARD",
+			BankType:    "ICBC_DEBIT",
+			BankAccount: tt.bankAccount,
+			RealName:    "张三",
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if refund.Status != "PROCESSING" || refund.Channel != "OTHER_BANKCARD" || refund.UserReceivedAccount != tt.wantAccount {
+			t.Errorf("%s: refund = %s %s %s, want PROCESSING OTHER_BANKCARD %s", tt.name, refund.Status, refund.Channel, refund.UserReceivedAccount, tt.wantAccount)
+		}
+	}
+}
+
+func TestRestoreRefundedOrder(t *testing.T) {
+	core.InitDB(filepath.Join(t.TempDir(), "sandbox.db"))
+	now := time.Now()
+	orders := []model.Transaction{
+		{MchID: "100", OutTradeNo: "ORDER_1", TransactionID: "4200000001", Amount: 100, Status: "REFUND", PaidAt: &now},
+		{MchID: "100", OutTradeNo: "ORDER_2", TransactionID: "4200000002", Amount: 100, Status: "REFUND", PaidAt: &now},
+		{MchID: "100", OutTradeNo: "ORDER_3", TransactionID: "4200000003", Amount: 100, Status: "CLOSED"},
+	}
+	for i := range orders {
+		core.DB.Create(&orders[i])
+	}
+	refunds := []model.Refund{
+		{RefundID: "5030000001", OutRefundNo: "REFUND_1", MchID: "100", TransactionID: "4200000001", Amount: 60, Status: "CLOSED"},
+		{RefundID: "5030000002", OutRefundNo: "REFUND_2", MchID: "100", TransactionID: "4200000002", Amount: 60, Status: "CLOSED"},
+		{RefundID: "5030000003", OutRefundNo: "REFUND_3", MchID: "100", TransactionID: "4200000002", Amount: 20, Status: "SUCCESS"},
+	}
+	for i := range refunds {
+		core.DB.Create(&refunds[i])
+	}
+
+	// 仅无其他有效退款的 REFUND 订单恢复为 SUCCESS
+	want := map[string]string{"4200000001": "SUCCESS", "4200000002": "REFUND", "4200000003": "CLOSED"}
+	for transactionID, status := range want {
+		restoreRefundedOrder(transactionID)
+		var tx model.Transaction
+		core.DB.Where("transaction_id = ?", transactionID).First(&tx)
+		if tx.Status != status {
+			t.Errorf("%s status = %s, want %s", transactionID, tx.Status, status)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/worker"
+
+	"gorm.io/gorm"
+)
+
+// maxTransferDetails 单个批次最多转账明细数量
+const maxTransferDetails = 1000
+
+// transferNameRequiredAmount 明细金额达到 2000 元时必须填写收款用户姓名
+const transferNameRequiredAmount = 200000
+
+// transferNameForbiddenAmount 明细金额低于 0.3 元时不允许填写收款用户姓名
+const transferNameForbiddenAmount = 30
+
+// defaultTransferFailReason 配置为失败但未指定原因时使用的失败原因
+const defaultTransferFailReason = "ACCOUNT_FROZEN"
+
+// transferLock 串行化转账批次的创建及明细状态变更
+var transferLock sync.Mutex
+
+// TransferConfig 转账处理配置 (商户 transfer_config 字段)
+type TransferConfig struct {
+	Delay       string            `json:"delay"`        // 处理时长，e.g. "3s"
+	Result      string            `json:"result"`       // 明细默认结果：SUCCESS, FAIL；MANUAL 表示保持处理中，等待手动操作
+	FailReason  string            `json:"fail_reason"`  // result 为 FAIL 时的失败原因
+	FailOpenIDs map[string]string `json:"fail_openids"` // 指定收款用户转账失败，value 为失败原因
+}
+
+// loadTransferConfig 读取商户转账处理配置，默认 3 秒后全部转账成功
+func loadTransferConfig(mchid string) (time.Duration, TransferConfig) {
+	delay := 3 * time.Second
+	config := TransferConfig{Result: "SUCCESS"}
+
+	var mch model.Merchant
+	if err := core.DB.Where("mch_id = ?", mchid).First(&mch).Error; err == nil {
+		var c TransferConfig
+		if json.Unmarshal([]byte(mch.TransferConfig), &c) == nil {
+			if d, err := time.ParseDuration(c.Delay); err == nil {
+				delay = d
+			}
+			if c.Result != "" {
+				config.Result = c.Result
+			}
+			config.FailReason = c.FailReason
+			config.FailOpenIDs = c.FailOpenIDs
+		}
+	}
+	return delay, config
+}
+
+// TransferDetailParams 转账明细参数
+type TransferDetailParams struct {
+	OutDetailNo    string
+	TransferAmount int64
+	TransferRemark string
+	OpenID         string
+	UserName       string // 使用平台证书公钥加密
+}
+
+// TransferBatchParams 发起批量转账参数
+type TransferBatchParams struct {
+	AppID           string
+	OutBatchNo      string
+	BatchName       string
+	BatchRemark     string
+	TotalAmount     int64
+	TotalNum        int
+	TransferSceneID string
+	NotifyUrl       string // 为空时使用商户配置
+	Details         []TransferDetailParams
+}
+
+// CreateTransferBatch 发起商家转账批次，批次以 ACCEPTED 受理，明细按商户转账配置异步处理
+func CreateTransferBatch(mchid string, p TransferBatchParams) (model.TransferBatch, error) {
+	var batch model.TransferBatch
+
+	if p.AppID == "" || p.OutBatchNo == "" || p.BatchName == "" || p.BatchRemark == "" {
+		return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "appid, out_batch_no, batch_name and batch_remark are required")
+	}
+	if len(p.Details) == 0 || len(p.Details) > maxTransferDetails {
+		return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", fmt.Sprintf("transfer_detail_list must contain 1 to %d items", maxTransferDetails))
+	}
+
+	var mch model.Merchant
+	if err := core.DB.Where("mch_id = ?", mchid).First(&mch).Error; err != nil {
+		return batch, NewBizError(http.StatusBadRequest, "MCH_NOT_FOUND", "Merchant not configured in sandbox")
+	}
+
+	var total int64
+	outDetailNos := make(map[string]bool, len(p.Details))
+	details := make([]model.TransferDetail, 0, len(p.Details))
+	for _, d := range p.Details {
+		if d.OutDetailNo == "" || d.OpenID == "" || d.TransferRemark == "" {
+			return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "out_detail_no, openid and transfer_remark are required")
+		}
+		if outDetailNos[d.OutDetailNo] {
+			return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "商家明细单号重复: "+d.OutDetailNo)
+		}
+		outDetailNos[d.OutDetailNo] = true
+		if d.TransferAmount <= 0 {
+			return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "转账金额必须大于 0")
+		}
+		if d.TransferAmount >= transferNameRequiredAmount && d.UserName == "" {
+			return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "明细金额大于等于2000元时user_name必填")
+		}
+		if d.TransferAmount < transferNameForbiddenAmount && d.UserName != "" {
+			return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "明细金额小于0.3元时不允许填写user_name")
+		}
+		total += d.TransferAmount
+
+		userName := d.UserName
+		if userName != "" {
+			userName = core.DecryptSensitive(mchid, userName)
+		}
+		details = append(details, model.TransferDetail{
+			OutDetailNo:    d.OutDetailNo,
+			TransferAmount: d.TransferAmount,
+			TransferRemark: d.TransferRemark,
+			OpenID:         d.OpenID,
+			UserName:       userName,
+		})
+	}
+	if p.TotalNum != len(details) {
+		return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "total_num与转账明细数量不一致")
+	}
+	if p.TotalAmount != total {
+		return batch, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "total_amount与转账明细金额之和不一致")
+	}
+
+	transferLock.Lock()
+	defer transferLock.Unlock()
+
+	// 同一商户批次单号重复提交：参数一致时返回原批次
+	err := core.DB.Where("out_batch_no = ? AND mch_id = ?", p.OutBatchNo, mchid).First(&batch).Error
+	if err == nil {
+		if batch.TotalAmount != p.TotalAmount || batch.TotalNum != p.TotalNum {
+			return batch, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "商家批次单号重复，且转账参数与原请求不一致")
+		}
+		return batch, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return batch, err
+	}
+
+	// 商家明细单号在商户内唯一 (跨批次)
+	nos := make([]string, 0, len(details))
+	for _, d := range details {
+		nos = append(nos, d.OutDetailNo)
+	}
+	var existing model.TransferDetail
+	err = core.DB.Joins("JOIN transfer_batches ON transfer_batches.id = transfer_details.transfer_batch_id").
+		Where("transfer_batches.mch_id = ? AND transfer_details.out_detail_no IN ?", mchid, nos).
+		First(&existing).Error
+	if err == nil {
+		return batch, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "商家明细单号已存在: "+existing.OutDetailNo)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return batch, err
+	}
+
+	notifyUrl := p.NotifyUrl
+	if notifyUrl == "" {
+		notifyUrl = mch.NotifyUrl
+	}
+
+	now := time.Now()
+	batch = model.TransferBatch{
+		BatchID:         fmt.Sprintf("131000%s%06d", now.Format("20060102150405"), rand.Intn(1000000)),
+		OutBatchNo:      p.OutBatchNo,
+		MchID:           mchid,
+		AppID:           p.AppID,
+		BatchName:       p.BatchName,
+		BatchRemark:     p.BatchRemark,
+		TransferSceneID: p.TransferSceneID,
+		NotifyUrl:       notifyUrl,
+		TotalAmount:     p.TotalAmount,
+		TotalNum:        p.TotalNum,
+		BatchStatus:     "ACCEPTED",
+	}
+	for i := range details {
+		details[i].DetailID = fmt.Sprintf("141000%s%04d%06d", now.Format("20060102150405"), i, rand.Intn(1000000))
+		details[i].DetailStatus = "PROCESSING"
+	}
+	batch.Details = details
+
+	if err := core.DB.Create(&batch).Error; err != nil {
+		return batch, err
+	}
+
+	scheduleTransferBatch(batch.BatchID)
+	return batch, nil
+}
+
+// scheduleTransferBatch 按商户转账配置在延迟后处理批次内的明细，MANUAL 时批次进入处理中等待手动操作
+func scheduleTransferBatch(batchID string) {
+	var batch model.TransferBatch
+	if err := core.DB.Where("batch_id = ?", batchID).First(&batch).Error; err != nil {
+		return
+	}
+	delay, config := loadTransferConfig(batch.MchID)
+
+	time.AfterFunc(delay, func() {
+		core.DB.Model(&model.TransferBatch{}).
+			Where("batch_id = ? AND batch_status = ?", batchID, "ACCEPTED").
+			Update("batch_status", "PROCESSING")
+		if config.Result == "MANUAL" {
+			return
+		}
+
+		var details []model.TransferDetail
+		core.DB.Where("transfer_batch_id = ? AND detail_status = ?", batch.ID, "PROCESSING").Find(&details)
+		for _, d := range details {
+			status, reason := "SUCCESS", ""
+			if r, ok := config.FailOpenIDs[d.OpenID]; ok {
+				status, reason = "FAIL", r
+			} else if config.Result == "FAIL" {
+				status, reason = "FAIL", config.FailReason
+			}
+			if _, err := CompleteTransferDetail(d.DetailID, status, reason); err != nil {
+				fmt.Printf("Transfer detail %s auto process skipped: %v\n", d.DetailID, err)
+			}
+		}
+	})
+}
+
+// ResumeTransfers 服务启动时重新调度未完成的转账批次
+func ResumeTransfers() {
+	var batches []model.TransferBatch
+	core.DB.Where("batch_status IN ?", []string{"ACCEPTED", "PROCESSING"}).Find(&batches)
+	for _, batch := range batches {
+		scheduleTransferBatch(batch.BatchID)
+	}
+}
+
+// CompleteTransferDetail 将处理中的转账明细推进到 SUCCESS / FAIL，批次内明细全部完成后批次完成并发送通知
+func CompleteTransferDetail(detailID, status, failReason string) (model.TransferDetail, error) {
+	var detail model.TransferDetail
+
+	switch status {
+	case "SUCCESS":
+		failReason = ""
+	case "FAIL":
+		if failReason == "" {
+			failReason = defaultTransferFailReason
+		}
+	default:
+		return detail, NewBizError(http.StatusBadRequest, "PARAM_ERROR", "明细状态只能为 SUCCESS 或 FAIL")
+	}
+
+	transferLock.Lock()
+	defer transferLock.Unlock()
+
+	if err := core.DB.Where("detail_id = ?", detailID).First(&detail).Error; err != nil {
+		return detail, NewBizError(http.StatusNotFound, "RESOURCE_NOT_EXISTS", "转账明细单不存在")
+	}
+	if detail.DetailStatus != "PROCESSING" {
+		return detail, NewBizError(http.StatusBadRequest, "INVALID_REQUEST", "转账明细单当前状态为 "+detail.DetailStatus+"，无法变更")
+	}
+
+	if err := core.DB.Model(&detail).Updates(map[string]interface{}{
+		"detail_status": status,
+		"fail_reason":   failReason,
+	}).Error; err != nil {
+		return detail, err
+	}
+	core.DB.First(&detail, detail.ID)
+
+	finishTransferBatch(detail.TransferBatchID)
+	return detail, nil
+}
+
+// finishTransferBatch 批次内已无处理中的明细时汇总成功/失败金额，批次完成并发送批次完成通知
+func finishTransferBatch(id uint) {
+	var batch model.TransferBatch
+	if err := core.DB.Preload("Details").First(&batch, id).Error; err != nil || batch.BatchStatus == "FINISHED" {
+		return
+	}
+
+	var successAmount, failAmount int64
+	var successNum, failNum int
+	for _, d := range batch.Details {
+		switch d.DetailStatus {
+		case "SUCCESS":
+			successAmount += d.TransferAmount
+			successNum++
+		case "FAIL":
+			failAmount += d.TransferAmount
+			failNum++
+		default:
+			return
+		}
+	}
+
+	updates := map[string]interface{}{
+		"batch_status":   "FINISHED",
+		"success_amount": successAmount,
+		"success_num":    successNum,
+		"fail_amount":    failAmount,
+		"fail_num":       failNum,
+	}
+	core.DB.Model(&batch).Updates(updates)
+
+	core.DB.First(&batch, batch.ID)
+	worker.TriggerTransferBatchCallback(batch)
+}
@@ -0,0 +1,85 @@
+// Package tradestate 定义微信支付订单状态 (trade_state) 及其合法流转
+// 所有修改 model.Transaction 状态的逻辑都应通过 Transit / CanTransit 校验
+package tradestate
+
+import (
+	"fmt"
+	"wepay-sandbox/internal/model"
+)
+
+// 订单状态，取值与微信支付 trade_state 一致
+const (
+	NotPay     = "NOTPAY"     // 未支付
+	UserPaying = "USERPAYING" // 用户支付中 (付款码支付)
+	PayError   = "PAYERROR"   // 支付失败 (付款码支付)
+	Success    = "SUCCESS"    // 支付成功
+	Refund     = "REFUND"     // 转入退款
+	Closed     = "CLOSED"     // 已关闭
+	Revoked    = "REVOKED"    // 已撤销 (付款码支付)
+)
+
+// descriptions 各状态对应的 trade_state_desc
+var descriptions = map[string]string{
+	NotPay:     "订单未支付",
+	UserPaying: "用户支付中，需要输入密码",
+	PayError:   "支付失败，请重新下单支付",
+	Success:    "支付成功",
+	Refund:     "订单发生过退款，退款详情请查询退款单",
+	Closed:     "订单已关闭",
+	Revoked:    "订单已撤销",
+}
+
+// transitions 合法的状态流转，CLOSED 与 REVOKED 为终态
+// 已支付订单只能通过退款退回资金，不能撤销；REFUND 不能重新支付，
+// 退款全部关闭后恢复为 SUCCESS 仅由退款处理单独完成，不属于支付流转
+var transitions = map[string][]string{
+	NotPay:     {Success, Closed, Revoked},
+	UserPaying: {Success, PayError, Closed, Revoked},
+	PayError:   {Closed, Revoked},
+	Success:    {Refund},
+}
+
+// TransitionError 非法的状态流转
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("订单状态为 %s，不能变更为 %s", e.From, e.To)
+}
+
+// Desc 返回状态对应的 trade_state_desc
+func Desc(state string) string {
+	return descriptions[state]
+}
+
+// CanTransit 状态 from 是否可以流转到 to
+func CanTransit(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources 可以流转到 to 的全部状态，用于批量更新时的状态条件
+func Sources(to string) []string {
+	var states []string
+	for _, from := range []string{NotPay, UserPaying, PayError, Success, Refund, Closed, Revoked} {
+		if CanTransit(from, to) {
+			states = append(states, from)
+		}
+	}
+	return states
+}
+
+// Transit 校验并变更订单状态 (不落库)，非法流转时返回 *TransitionError
+func Transit(tx *model.Transaction, to string) error {
+	if !CanTransit(tx.Status, to) {
+		return &TransitionError{From: tx.Status, To: to}
+	}
+	tx.Status = to
+	return nil
+}
@@ -0,0 +1,91 @@
+package tradestate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"wepay-sandbox/internal/model"
+)
+
+func TestCanTransit(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{NotPay, Success, true},
+		{NotPay, Closed, true},
+		{NotPay, Revoked, true},
+		{NotPay, PayError, false},
+		{NotPay, Refund, false},
+		{UserPaying, Success, true},
+		{UserPaying, PayError, true},
+		{UserPaying, Closed, true},
+		{UserPaying, Revoked, true},
+		{PayError, Closed, true},
+		{PayError, Revoked, true},
+		{PayError, Success, false},
+		{Success, Refund, true},
+		{Success, Revoked, false}, // 已支付订单只能退款
+		{Success, Closed, false},
+		{Success, Success, false},
+		{Refund, Success, false}, // 转入退款的订单不能重新支付
+		{Refund, Closed, false},
+		{Closed, Success, false},
+		{Closed, NotPay, false},
+		{Revoked, Success, false},
+		{"CREATED", Success, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransit(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransit(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransit(t *testing.T) {
+	tests := []struct {
+		from, to   string
+		wantStatus string
+		wantErr    bool
+	}{
+		{NotPay, Success, Success, false},
+		{UserPaying, PayError, PayError, false},
+		{Success, Refund, Refund, false},
+		{Refund, Success, Refund, true},
+		{Closed, Success, Closed, true},
+		{Success, Revoked, Success, true},
+		{PayError, Success, PayError, true},
+	}
+	for _, tt := range tests {
+		tx := model.Transaction{Status: tt.from}
+		err := Transit(&tx, tt.to)
+		if tx.Status != tt.wantStatus {
+			t.Errorf("Transit(%s -> %s) status = %s, want %s", tt.from, tt.to, tx.Status, tt.wantStatus)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Transit(%s -> %s) err = %v, wantErr %v", tt.from, tt.to, err, tt.wantErr)
+			continue
+		}
+		var te *TransitionError
+		if err != nil && (!errors.As(err, &te) || te.From != tt.from || te.To != tt.to) {
+			t.Errorf("Transit(%s -> %s) err = %#v, want *TransitionError", tt.from, tt.to, err)
+		}
+	}
+}
+
+func TestSources(t *testing.T) {
+	tests := []struct {
+		to   string
+		want []string
+	}{
+		{Closed, []string{NotPay, UserPaying, PayError}},
+		{Success, []string{NotPay, UserPaying}},
+		{Revoked, []string{NotPay, UserPaying, PayError}},
+		{NotPay, nil},
+	}
+	for _, tt := range tests {
+		if got := Sources(tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Sources(%s) = %v, want %v", tt.to, got, tt.want)
+		}
+	}
+}
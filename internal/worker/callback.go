@@ -1,10 +1,8 @@
 package worker
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 	"wepay-sandbox/internal/api"
@@ -41,9 +39,13 @@ func TriggerCallback(tx model.Transaction) {
 		maxRetries := 3
 		retryInterval := 5 * time.Second
 
-		// 查询商户配置
+		// 查询商户配置 (服务商模式下通知由服务商接收，使用服务商的配置、密钥及回调地址)
+		notifyMchID := tx.MchID
+		if tx.SpMchID != "" {
+			notifyMchID = tx.SpMchID
+		}
 		var mch model.Merchant
-		if err := core.DB.Where("mch_id = ?", tx.MchID).First(&mch).Error; err == nil {
+		if err := core.DB.Where("mch_id = ?", notifyMchID).First(&mch).Error; err == nil {
 			var config NotifyConfig
 			if json.Unmarshal([]byte(mch.NotifyConfig), &config) == nil {
 				if config.MaxRetries > 0 {
@@ -55,34 +57,20 @@ func TriggerCallback(tx model.Transaction) {
 			}
 		}
 
-		payload := map[string]interface{}{
-			"id":             tx.TransactionID, // 通知ID
-			"create_time":    time.Now().Format(time.RFC3339),
-			"resource_type":  "encrypt-resource",
-			"event_type":     "TRANSACTION.SUCCESS",
-			"summary":        "支付成功",
-			"original_type":  "transaction",
-			"transaction_id": tx.TransactionID,
-			"out_trade_no":   tx.OutTradeNo,
-			"appid":          tx.AppID,
-			"mchid":          tx.MchID,
-			"trade_state":    "SUCCESS",
-			"amount": map[string]interface{}{
-				"total":    tx.Amount,
-				"currency": tx.Currency,
-			},
-			"success_time": time.Now().Format(time.RFC3339),
-			// 注意：这里省略了真实的加密逻辑，直接返回明文以便调试，或者模拟加密结构
-			"resource": map[string]interface{}{
-				"original_type":   "transaction",
-				"algorithm":       "AEAD_AES_256_GCM",
-				"ciphertext":      "mock_ciphertext", // 真实场景需加密
-				"associated_data": "",
-				"nonce":           "",
-			},
+		notifyUrl := tx.NotifyUrl
+		if notifyUrl == "" {
+			notifyUrl = mch.NotifyUrl
 		}
 
-		jsonBody, _ := json.Marshal(payload)
+		jsonBody, err := buildNotifyBody(mch, tx.TransactionID, "TRANSACTION.SUCCESS", "支付成功", "transaction", transactionResource(tx))
+		if err != nil {
+			fmt.Printf("Transaction %s build notify body failed: %v\n", tx.TransactionID, err)
+			core.DB.Model(&tx).Updates(map[string]interface{}{
+				"callback_status": "FAIL",
+				"callback_msg":    err.Error(),
+			})
+			return
+		}
 
 		for i := 0; i < maxRetries; i++ {
 
@@ -106,7 +94,7 @@ func TriggerCallback(tx model.Transaction) {
 				continue
 			}
 
-			resp, err := http.Post(tx.NotifyUrl, "application/json", bytes.NewBuffer(jsonBody))
+			resp, err := postNotify(notifyMchID, notifyUrl, jsonBody)
 
 			status := "FAIL"
 			statusCode := 0
@@ -124,11 +112,12 @@ func TriggerCallback(tx model.Transaction) {
 
 			// 请求结束，释放锁
 			callbackLocks.Delete(tx.TransactionID)
-			fmt.Println(int(existingLogsCount) + 1)
+
 			// 记录日志
 			log := model.CallbackLog{
 				TransactionID: tx.TransactionID,
-				NotifyUrl:     tx.NotifyUrl,
+				EventType:     "TRANSACTION.SUCCESS",
+				NotifyUrl:     notifyUrl,
 				RequestBody:   string(jsonBody),
 				ResponseBody:  respBody,
 				StatusCode:    statusCode,
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/api"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+)
+
+var (
+	// combineCallbackLocks 合单回调并发锁，key 为 CombineCallbackKey
+	combineCallbackLocks sync.Map
+)
+
+// CombineCallbackKey 合单回调日志及并发锁的 key：合单商户订单号仅在合单商户内唯一，需带上合单商户号
+func CombineCallbackKey(order model.CombineOrder) string {
+	return order.CombineMchID + "/" + order.CombineOutTradeNo
+}
+
+// TriggerCombineCallback 触发合单支付回调
+// 合单只发送一次通知 (包含全部子单)，由合单商户签名并使用其 APIv3 密钥加密
+func TriggerCombineCallback(order model.CombineOrder) {
+	go func() {
+		// 1. 检查是否已经回调成功
+		var current model.CombineOrder
+		if err := core.DB.Preload("SubOrders").First(&current, order.ID).Error; err == nil {
+			if current.CallbackStatus == "SUCCESS" {
+				fmt.Printf("Combine order %s callback already SUCCESS, skip.\n", order.CombineOutTradeNo)
+				return
+			}
+			// 使用最新数据
+			order = current
+		}
+
+		// 默认策略
+		maxRetries := 3
+		retryInterval := 5 * time.Second
+
+		// 查询合单商户配置
+		var mch model.Merchant
+		if err := core.DB.Where("mch_id = ?", order.CombineMchID).First(&mch).Error; err == nil {
+			var config NotifyConfig
+			if json.Unmarshal([]byte(mch.NotifyConfig), &config) == nil {
+				if config.MaxRetries > 0 {
+					maxRetries = config.MaxRetries
+				}
+				if d, err := time.ParseDuration(config.Interval); err == nil {
+					retryInterval = d
+				}
+			}
+		}
+
+		notifyUrl := order.NotifyUrl
+		if notifyUrl == "" {
+			notifyUrl = mch.NotifyUrl
+		}
+
+		key := CombineCallbackKey(order)
+		jsonBody, err := buildNotifyBody(mch, order.CombineOutTradeNo, "TRANSACTION.SUCCESS", "支付成功", "transaction", combineResource(order))
+		if err != nil {
+			fmt.Printf("Combine order %s build notify body failed: %v\n", order.CombineOutTradeNo, err)
+			updateCombineCallbackStatus(order, "FAIL", err.Error())
+			return
+		}
+
+		for i := 0; i < maxRetries; i++ {
+			if i > 0 {
+				time.Sleep(retryInterval)
+			}
+
+			// 每次重试前实时查询已尝试次数 (日志以合单商户号及合单商户订单号记录)
+			var existingLogsCount int64
+			core.DB.Model(&model.CallbackLog{}).Where("transaction_id = ?", key).Count(&existingLogsCount)
+
+			if int(existingLogsCount) >= maxRetries {
+				fmt.Printf("Combine order %s already reached max retries (%d), stop retry loop.\n", order.CombineOutTradeNo, maxRetries)
+				return
+			}
+
+			// 在实际发起 HTTP 请求前加锁
+			if _, loaded := combineCallbackLocks.LoadOrStore(key, true); loaded {
+				fmt.Printf("Combine order %s individual callback attempt is already in progress, skip this loop.\n", order.CombineOutTradeNo)
+				continue
+			}
+
+			resp, err := postNotify(order.CombineMchID, notifyUrl, jsonBody)
+
+			status := "FAIL"
+			statusCode := 0
+			respBody := ""
+
+			if err == nil {
+				statusCode = resp.StatusCode
+				if statusCode >= 200 && statusCode < 300 {
+					status = "SUCCESS"
+				}
+				resp.Body.Close()
+			} else {
+				respBody = err.Error()
+			}
+
+			// 请求结束，释放锁
+			combineCallbackLocks.Delete(key)
+
+			// 记录日志
+			log := model.CallbackLog{
+				TransactionID: key,
+				EventType:     "TRANSACTION.SUCCESS",
+				NotifyUrl:     notifyUrl,
+				RequestBody:   string(jsonBody),
+				ResponseBody:  respBody,
+				StatusCode:    statusCode,
+				Status:        status,
+				RetryCount:    int(existingLogsCount) + 1,
+			}
+			core.DB.Create(&log)
+
+			// 广播事件
+			api.GlobalEventChan <- api.Event{
+				Type: "callback",
+				Payload: map[string]interface{}{
+					"transaction_id": key,
+					"out_trade_no":   order.CombineOutTradeNo,
+					"status":         status,
+					"message":        fmt.Sprintf("新的合单回调产生，合单商户订单号：%s", order.CombineOutTradeNo),
+				},
+			}
+
+			updateCombineCallbackStatus(order, status, respBody)
+
+			if status == "SUCCESS" {
+				break
+			}
+		}
+	}()
+}
+
+// updateCombineCallbackStatus 同步更新合单及其子单的回调状态
+func updateCombineCallbackStatus(order model.CombineOrder, status, msg string) {
+	updates := map[string]interface{}{
+		"callback_status": status,
+		"callback_msg":    msg,
+	}
+	core.DB.Model(&order).Updates(updates)
+	core.DB.Model(&model.Transaction{}).Where("combine_id = ?", order.ID).Updates(updates)
+}
@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+	"wepay-sandbox/internal/tradestate"
+)
+
+// buildNotifyBody 构建回调通知报文
+// resource 使用商户 APIv3 密钥按 AEAD_AES_256_GCM 加密；商户开启调试模式时额外将明文字段平铺在顶层
+func buildNotifyBody(mch model.Merchant, id, eventType, summary, originalType string, resource map[string]interface{}) ([]byte, error) {
+	plaintext, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := core.RandomString(12)
+	ciphertext, err := core.EncryptAESGCM(mch.APIV3Key, nonce, originalType, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{}
+	if mch.NotifyDebug {
+		for k, v := range resource {
+			payload[k] = v
+		}
+	}
+
+	payload["id"] = id
+	payload["create_time"] = time.Now().Format(time.RFC3339)
+	payload["resource_type"] = "encrypt-resource"
+	payload["event_type"] = eventType
+	payload["summary"] = summary
+	payload["resource"] = map[string]interface{}{
+		"original_type":   originalType,
+		"algorithm":       "AEAD_AES_256_GCM",
+		"ciphertext":      ciphertext,
+		"associated_data": originalType,
+		"nonce":           nonce,
+	}
+
+	return json.Marshal(payload)
+}
+
+// postNotify 发送回调请求，并附带平台证书签名头 (Wechatpay-Signature 等)
+func postNotify(mchid, notifyUrl string, body []byte) (*http.Response, error) {
+	headers, err := core.SignatureHeaders(mchid, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, notifyUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// transactionResource 支付通知解密后的交易数据
+func transactionResource(tx model.Transaction) map[string]interface{} {
+	successTime := tx.UpdatedAt
+	if tx.PaidAt != nil {
+		successTime = *tx.PaidAt
+	}
+
+	openID := tx.PayerOpenID
+	if openID == "" {
+		openID = "mock_openid_123"
+	}
+
+	resource := map[string]interface{}{
+		"appid":            tx.AppID,
+		"mchid":            tx.MchID,
+		"out_trade_no":     tx.OutTradeNo,
+		"transaction_id":   tx.TransactionID,
+		"trade_type":       tx.TradeType,
+		"trade_state":      tradestate.Success,
+		"trade_state_desc": tradestate.Desc(tradestate.Success),
+		"bank_type":        "OTHERS",
+		"attach":           tx.Attach,
+		"success_time":     successTime.Format(time.RFC3339),
+		"payer": map[string]interface{}{
+			"openid": openID,
+		},
+		"amount": map[string]interface{}{
+			"total":          tx.Amount,
+			"payer_total":    tx.Amount,
+			"currency":       tx.Currency,
+			"payer_currency": tx.Currency,
+		},
+	}
+
+	// 服务商模式使用 sp_/sub_ 前缀字段
+	if tx.SpMchID != "" {
+		delete(resource, "appid")
+		delete(resource, "mchid")
+		resource["sp_appid"] = tx.SpAppID
+		resource["sp_mchid"] = tx.SpMchID
+		resource["sub_appid"] = tx.AppID
+		resource["sub_mchid"] = tx.MchID
+		resource["payer"] = map[string]interface{}{
+			"sp_openid":  tx.PayerOpenID,
+			"sub_openid": tx.PayerSubOpenID,
+		}
+	}
+	return resource
+}
+
+// combineResource 合单支付通知解密后的合单数据
+func combineResource(order model.CombineOrder) map[string]interface{} {
+	successTime := order.UpdatedAt
+	if order.PaidAt != nil {
+		successTime = *order.PaidAt
+	}
+
+	subOrders := make([]map[string]interface{}, 0, len(order.SubOrders))
+	for _, sub := range order.SubOrders {
+		subOrders = append(subOrders, map[string]interface{}{
+			"mchid":          sub.MchID,
+			"trade_type":     sub.TradeType,
+			"trade_state":    sub.Status,
+			"bank_type":      "OTHERS",
+			"attach":         sub.Attach,
+			"success_time":   successTime.Format(time.RFC3339),
+			"transaction_id": sub.TransactionID,
+			"out_trade_no":   sub.OutTradeNo,
+			"amount": map[string]interface{}{
+				"total_amount":   sub.Amount,
+				"payer_amount":   sub.Amount,
+				"currency":       sub.Currency,
+				"payer_currency": sub.Currency,
+			},
+		})
+	}
+
+	resource := map[string]interface{}{
+		"combine_appid":        order.CombineAppID,
+		"combine_mchid":        order.CombineMchID,
+		"combine_out_trade_no": order.CombineOutTradeNo,
+		"sub_orders":           subOrders,
+		"combine_payer_info": map[string]interface{}{
+			"openid": order.PayerOpenID,
+		},
+	}
+
+	var sceneInfo map[string]interface{}
+	if json.Unmarshal([]byte(order.SceneInfo), &sceneInfo) == nil && sceneInfo != nil {
+		resource["scene_info"] = sceneInfo
+	}
+	return resource
+}
+
+// refundResource 退款通知解密后的退款数据
+func refundResource(refund model.Refund, outTradeNo string) map[string]interface{} {
+	resource := map[string]interface{}{
+		"mchid":                 refund.MchID,
+		"out_trade_no":          outTradeNo,
+		"transaction_id":        refund.TransactionID,
+		"out_refund_no":         refund.OutRefundNo,
+		"refund_id":             refund.RefundID,
+		"refund_status":         refund.Status,
+		"user_received_account": refund.UserReceivedAccount,
+		"amount": map[string]interface{}{
+			"total":        refund.Total,
+			"refund":       refund.Amount,
+			"payer_total":  refund.Total,
+			"payer_refund": refund.Amount,
+		},
+	}
+	if refund.SuccessAt != nil {
+		resource["success_time"] = refund.SuccessAt.Format(time.RFC3339)
+	}
+	if refund.SpMchID != "" {
+		delete(resource, "mchid")
+		resource["sp_mchid"] = refund.SpMchID
+		resource["sub_mchid"] = refund.MchID
+	}
+	return resource
+}
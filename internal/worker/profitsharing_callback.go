@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/api"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+)
+
+var (
+	// profitSharingCallbackLocks 分账回调并发锁，key 为分账明细单号或回退单号
+	profitSharingCallbackLocks sync.Map
+)
+
+// TriggerProfitSharingCallback 触发分账动账通知 (每个接收方一条)
+func TriggerProfitSharingCallback(order model.ProfitSharingOrder, detail model.ProfitSharingDetail) {
+	eventType, summary := "PROFITSHARING.SUCCESS", "分账成功"
+	if detail.Result == "CLOSED" {
+		eventType, summary = "PROFITSHARING.CLOSED", "分账失败"
+	}
+
+	successTime := detail.CreatedAt
+	if detail.FinishedAt != nil {
+		successTime = *detail.FinishedAt
+	}
+	resource := profitSharingResource(order.MchID, order.SpMchID, order.TransactionID, order.OrderID, order.OutOrderNo, successTime)
+	resource["receiver"] = map[string]interface{}{
+		"type":        detail.Type,
+		"account":     detail.Account,
+		"amount":      detail.Amount,
+		"description": detail.Description,
+	}
+
+	go sendProfitSharingNotify(detail.DetailID, eventType, summary, order.MchID, order.SpMchID, resource, func(status string) {
+		core.DB.Model(&model.ProfitSharingDetail{}).Where("id = ?", detail.ID).Update("callback_status", status)
+	})
+}
+
+// TriggerProfitSharingReturnCallback 触发分账回退动账通知
+func TriggerProfitSharingReturnCallback(ret model.ProfitSharingReturn) {
+	var order model.ProfitSharingOrder
+	core.DB.Where("order_id = ?", ret.OrderID).First(&order)
+
+	successTime := ret.CreatedAt
+	if ret.FinishedAt != nil {
+		successTime = *ret.FinishedAt
+	}
+	resource := profitSharingResource(ret.MchID, ret.SpMchID, order.TransactionID, ret.OrderID, ret.OutOrderNo, successTime)
+	resource["return_id"] = ret.ReturnID
+	resource["out_return_no"] = ret.OutReturnNo
+	resource["receiver"] = map[string]interface{}{
+		"type":        "MERCHANT_ID",
+		"account":     ret.ReturnMchID,
+		"amount":      ret.Amount,
+		"description": ret.Description,
+	}
+
+	go sendProfitSharingNotify(ret.ReturnID, "PROFITSHARING.RETURN", "分账回退", ret.MchID, ret.SpMchID, resource, func(status string) {
+		core.DB.Model(&model.ProfitSharingReturn{}).Where("id = ?", ret.ID).Update("callback_status", status)
+	})
+}
+
+// profitSharingResource 分账通知解密后的公共字段，服务商模式使用 sp_mchid/sub_mchid
+func profitSharingResource(mchid, spMchID, transactionID, orderID, outOrderNo string, successTime time.Time) map[string]interface{} {
+	resource := map[string]interface{}{
+		"mchid":          mchid,
+		"transaction_id": transactionID,
+		"order_id":       orderID,
+		"out_order_no":   outOrderNo,
+		"success_time":   successTime.Format(time.RFC3339),
+	}
+	if spMchID != "" {
+		delete(resource, "mchid")
+		resource["sp_mchid"] = spMchID
+		resource["sub_mchid"] = mchid
+	}
+	return resource
+}
+
+// sendProfitSharingNotify 按商户回调配置发送分账通知并重试，key 用于日志及并发控制
+func sendProfitSharingNotify(key, eventType, summary, mchid, spMchID string, resource map[string]interface{}, onResult func(status string)) {
+	// 服务商模式下通知由服务商接收
+	notifyMchID := mchid
+	if spMchID != "" {
+		notifyMchID = spMchID
+	}
+
+	// 默认策略
+	maxRetries := 3
+	retryInterval := 5 * time.Second
+
+	var mch model.Merchant
+	if err := core.DB.Where("mch_id = ?", notifyMchID).First(&mch).Error; err == nil {
+		var config NotifyConfig
+		if json.Unmarshal([]byte(mch.NotifyConfig), &config) == nil {
+			if config.MaxRetries > 0 {
+				maxRetries = config.MaxRetries
+			}
+			if d, err := time.ParseDuration(config.Interval); err == nil {
+				retryInterval = d
+			}
+		}
+	}
+
+	jsonBody, err := buildNotifyBody(mch, key, eventType, summary, "profitsharing", resource)
+	if err != nil {
+		fmt.Printf("Profit sharing %s build notify body failed: %v\n", key, err)
+		onResult("FAIL")
+		return
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			time.Sleep(retryInterval)
+		}
+
+		var existingLogsCount int64
+		core.DB.Model(&model.CallbackLog{}).Where("transaction_id = ? AND event_type = ?", key, eventType).Count(&existingLogsCount)
+		if int(existingLogsCount) >= maxRetries {
+			fmt.Printf("Profit sharing %s already reached max retries (%d), stop retry loop.\n", key, maxRetries)
+			return
+		}
+
+		if _, loaded := profitSharingCallbackLocks.LoadOrStore(key, true); loaded {
+			fmt.Printf("Profit sharing %s individual callback attempt is already in progress, skip this loop.\n", key)
+			continue
+		}
+
+		resp, err := postNotify(notifyMchID, mch.NotifyUrl, jsonBody)
+
+		status := "FAIL"
+		statusCode := 0
+		respBody := ""
+
+		if err == nil {
+			statusCode = resp.StatusCode
+			if statusCode >= 200 && statusCode < 300 {
+				status = "SUCCESS"
+			}
+			resp.Body.Close()
+		} else {
+			respBody = err.Error()
+		}
+
+		profitSharingCallbackLocks.Delete(key)
+
+		core.DB.Create(&model.CallbackLog{
+			TransactionID: key,
+			EventType:     eventType,
+			NotifyUrl:     mch.NotifyUrl,
+			RequestBody:   string(jsonBody),
+			ResponseBody:  respBody,
+			StatusCode:    statusCode,
+			Status:        status,
+			RetryCount:    int(existingLogsCount) + 1,
+		})
+
+		api.GlobalEventChan <- api.Event{
+			Type: "callback",
+			Payload: map[string]interface{}{
+				"transaction_id": key,
+				"out_trade_no":   resource["out_order_no"],
+				"status":         status,
+				"message":        fmt.Sprintf("新的分账回调产生，商户分账单号：%v", resource["out_order_no"]),
+			},
+		}
+
+		onResult(status)
+
+		if status == "SUCCESS" {
+			break
+		}
+	}
+}
@@ -1,10 +1,8 @@
 package worker
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 	"wepay-sandbox/internal/api"
@@ -35,9 +33,13 @@ func TriggerRefundCallback(refund model.Refund) {
 		maxRetries := 3
 		retryInterval := 5 * time.Second
 
-		// 查询商户配置
+		// 查询商户配置 (服务商模式下通知由服务商接收)
+		notifyMchID := refund.MchID
+		if refund.SpMchID != "" {
+			notifyMchID = refund.SpMchID
+		}
 		var mch model.Merchant
-		if err := core.DB.Where("mch_id = ?", refund.MchID).First(&mch).Error; err == nil {
+		if err := core.DB.Where("mch_id = ?", notifyMchID).First(&mch).Error; err == nil {
 			var config NotifyConfig
 			if json.Unmarshal([]byte(mch.NotifyConfig), &config) == nil {
 				if config.MaxRetries > 0 {
@@ -49,42 +51,34 @@ func TriggerRefundCallback(refund model.Refund) {
 			}
 		}
 
-		payload := map[string]interface{}{
-			"id":             refund.RefundID, // 通知ID
-			"create_time":    time.Now().Format(time.RFC3339),
-			"resource_type":  "encrypt-resource",
-			"event_type":     "REFUND.SUCCESS",
-			"summary":        "退款成功",
-			"original_type":  "refund",
-			"refund_id":      refund.RefundID,
-			"out_refund_no":  refund.OutRefundNo,
-			"transaction_id": refund.TransactionID,
-			"mchid":          refund.MchID,
-			"refund_status":  "SUCCESS",
-			"amount": map[string]interface{}{
-				"refund":   refund.Amount,
-				"total":    refund.Total,
-				"currency": refund.Currency,
-			},
-			"success_time": time.Now().Format(time.RFC3339),
-			"resource": map[string]interface{}{
-				"original_type":   "refund",
-				"algorithm":       "AEAD_AES_256_GCM",
-				"ciphertext":      "mock_refund_ciphertext",
-				"associated_data": "",
-				"nonce":           "",
-			},
+		// 退款通知需携带原支付订单的商户订单号
+		var tx model.Transaction
+		core.DB.Where("transaction_id = ?", refund.TransactionID).First(&tx)
+
+		// 通知类型由退款单当前状态决定
+		eventType, summary := refundEvent(refund.Status)
+		if eventType == "" {
+			fmt.Printf("Refund %s is %s, no notification needed.\n", refund.RefundID, refund.Status)
+			return
 		}
 
-		jsonBody, _ := json.Marshal(payload)
+		jsonBody, err := buildNotifyBody(mch, refund.RefundID, eventType, summary, "refund", refundResource(refund, tx.OutTradeNo))
+		if err != nil {
+			fmt.Printf("Refund %s build notify body failed: %v\n", refund.RefundID, err)
+			core.DB.Model(&refund).Updates(map[string]interface{}{
+				"callback_status": "FAIL",
+				"callback_msg":    err.Error(),
+			})
+			return
+		}
 
 		for i := 0; i < maxRetries; i++ {
 			if i > 0 {
 				time.Sleep(retryInterval)
 			}
-			// 每次重试前实时查询已尝试次数
+			// 每次重试前实时查询已尝试次数 (按通知类型分别计数，退款状态变化后可再次通知)
 			var existingLogsCount int64
-			core.DB.Model(&model.CallbackLog{}).Where("transaction_id = ?", refund.RefundID).Count(&existingLogsCount)
+			core.DB.Model(&model.CallbackLog{}).Where("transaction_id = ? AND event_type = ?", refund.RefundID, eventType).Count(&existingLogsCount)
 
 			if int(existingLogsCount) >= maxRetries {
 				fmt.Printf("Refund %s already reached max retries (%d), stop retry loop.\n", refund.RefundID, maxRetries)
@@ -104,7 +98,7 @@ func TriggerRefundCallback(refund model.Refund) {
 				notifyUrl = mch.NotifyUrl // Fallback
 			}
 
-			resp, err := http.Post(notifyUrl, "application/json", bytes.NewBuffer(jsonBody))
+			resp, err := postNotify(notifyMchID, notifyUrl, jsonBody)
 
 			status := "FAIL"
 			statusCode := 0
@@ -126,6 +120,7 @@ func TriggerRefundCallback(refund model.Refund) {
 			// 记录日志 (复用 CallbackLog, TransactionID 存 RefundID 方便查询)
 			log := model.CallbackLog{
 				TransactionID: refund.RefundID, // 注意：这里存的是退款单号，以便在退款流水中查询
+				EventType:     eventType,
 				NotifyUrl:     notifyUrl,
 				RequestBody:   string(jsonBody),
 				ResponseBody:  respBody,
@@ -158,3 +153,17 @@ func TriggerRefundCallback(refund model.Refund) {
 		}
 	}()
 }
+
+// refundEvent 根据退款状态获取通知类型及摘要，处理中的退款不发送通知
+func refundEvent(status string) (string, string) {
+	switch status {
+	case "SUCCESS":
+		return "REFUND.SUCCESS", "退款成功"
+	case "ABNORMAL":
+		return "REFUND.ABNORMAL", "退款异常"
+	case "CLOSED":
+		return "REFUND.CLOSED", "退款关闭"
+	default:
+		return "", ""
+	}
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"wepay-sandbox/internal/api"
+	"wepay-sandbox/internal/core"
+	"wepay-sandbox/internal/model"
+)
+
+var (
+	// transferCallbackLocks 转账批次回调并发锁，key 为 BatchID
+	transferCallbackLocks sync.Map
+)
+
+// TriggerTransferBatchCallback 触发商家转账批次完成通知
+func TriggerTransferBatchCallback(batch model.TransferBatch) {
+	go func() {
+		// 默认策略
+		maxRetries := 3
+		retryInterval := 5 * time.Second
+
+		var mch model.Merchant
+		if err := core.DB.Where("mch_id = ?", batch.MchID).First(&mch).Error; err == nil {
+			var config NotifyConfig
+			if json.Unmarshal([]byte(mch.NotifyConfig), &config) == nil {
+				if config.MaxRetries > 0 {
+					maxRetries = config.MaxRetries
+				}
+				if d, err := time.ParseDuration(config.Interval); err == nil {
+					retryInterval = d
+				}
+			}
+		}
+
+		eventType := "MCHTRANSFER.BATCH.FINISHED"
+		jsonBody, err := buildNotifyBody(mch, batch.BatchID, eventType, "商家转账批次完成", "mch_payment", transferBatchResource(batch))
+		if err != nil {
+			fmt.Printf("Transfer batch %s build notify body failed: %v\n", batch.BatchID, err)
+			core.DB.Model(&batch).Update("callback_status", "FAIL")
+			return
+		}
+
+		notifyUrl := batch.NotifyUrl
+		if notifyUrl == "" {
+			notifyUrl = mch.NotifyUrl
+		}
+
+		for i := 0; i < maxRetries; i++ {
+			if i > 0 {
+				time.Sleep(retryInterval)
+			}
+
+			var existingLogsCount int64
+			core.DB.Model(&model.CallbackLog{}).Where("transaction_id = ? AND event_type = ?", batch.BatchID, eventType).Count(&existingLogsCount)
+			if int(existingLogsCount) >= maxRetries {
+				fmt.Printf("Transfer batch %s already reached max retries (%d), stop retry loop.\n", batch.BatchID, maxRetries)
+				return
+			}
+
+			if _, loaded := transferCallbackLocks.LoadOrStore(batch.BatchID, true); loaded {
+				fmt.Printf("Transfer batch %s individual callback attempt is already in progress, skip this loop.\n", batch.BatchID)
+				continue
+			}
+
+			resp, err := postNotify(batch.MchID, notifyUrl, jsonBody)
+
+			status := "FAIL"
+			statusCode := 0
+			respBody := ""
+
+			if err == nil {
+				statusCode = resp.StatusCode
+				if statusCode >= 200 && statusCode < 300 {
+					status = "SUCCESS"
+				}
+				resp.Body.Close()
+			} else {
+				respBody = err.Error()
+			}
+
+			transferCallbackLocks.Delete(batch.BatchID)
+
+			// 复用 CallbackLog，TransactionID 存 BatchID
+			core.DB.Create(&model.CallbackLog{
+				TransactionID: batch.BatchID,
+				EventType:     eventType,
+				NotifyUrl:     notifyUrl,
+				RequestBody:   string(jsonBody),
+				ResponseBody:  respBody,
+				StatusCode:    statusCode,
+				Status:        status,
+				RetryCount:    int(existingLogsCount) + 1,
+			})
+
+			api.GlobalEventChan <- api.Event{
+				Type: "callback",
+				Payload: map[string]interface{}{
+					"transaction_id": batch.BatchID,
+					"out_trade_no":   batch.OutBatchNo,
+					"status":         status,
+					"message":        fmt.Sprintf("新的转账回调产生，商家批次单号：%s", batch.OutBatchNo),
+				},
+			}
+
+			core.DB.Model(&batch).Update("callback_status", status)
+
+			if status == "SUCCESS" {
+				break
+			}
+		}
+	}()
+}
+
+// transferBatchResource 转账批次完成通知解密后的数据
+func transferBatchResource(batch model.TransferBatch) map[string]interface{} {
+	return map[string]interface{}{
+		"mchid":          batch.MchID,
+		"out_batch_no":   batch.OutBatchNo,
+		"batch_id":       batch.BatchID,
+		"batch_status":   batch.BatchStatus,
+		"total_num":      batch.TotalNum,
+		"total_amount":   batch.TotalAmount,
+		"success_amount": batch.SuccessAmount,
+		"success_num":    batch.SuccessNum,
+		"fail_amount":    batch.FailAmount,
+		"fail_num":       batch.FailNum,
+		"update_time":    batch.UpdatedAt.Format(time.RFC3339),
+	}
+}
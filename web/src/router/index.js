@@ -3,6 +3,8 @@ import AdminLayout from '../views/admin/Layout.vue'
 import MerchantList from '../views/admin/MerchantList.vue'
 import TransactionList from '../views/admin/TransactionList.vue'
 import RefundList from '../views/admin/RefundList.vue'
+import ProfitSharingList from '../views/admin/ProfitSharingList.vue'
+import TransferList from '../views/admin/TransferList.vue'
 import PayPreview from '../views/mobile/PayPreview.vue'
 
 const router = createRouter({
@@ -15,6 +17,8 @@ const router = createRouter({
         { path: 'merchants', component: MerchantList },
         { path: 'transactions', component: TransactionList },
         { path: 'refunds', component: RefundList },
+        { path: 'profitsharing', component: ProfitSharingList },
+        { path: 'transfers', component: TransferList },
         { path: '', redirect: '/admin/merchants' }
       ]
     },